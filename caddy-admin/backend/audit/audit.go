@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bufio"
+	"caddy-admin/caddy"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionRegister    = "service.register"
+	ActionUpdate      = "service.update"
+	ActionDeregister  = "service.deregister"
+	ActionExpire      = "service.expire"
+	ActionSync        = "service.sync"
+	ActionDriftFix    = "service.drift_fix"
+	ActionReplay      = "service.replay"
+	ActionRollback    = "history.rollback"
+	ActionTokenCreate = "token.create"
+	ActionTokenDelete = "token.delete"
+	ActionCertReload  = "cert.reload"
+)
+
+// Entry is one audit record.
+type Entry struct {
+	Seq      int64                `json:"seq"`
+	Time     time.Time            `json:"time"`
+	Actor    string               `json:"actor"`
+	TokenID  string               `json:"tokenId,omitempty"`
+	SourceIP string               `json:"sourceIp,omitempty"`
+	Action   string               `json:"action"`
+	Target   string               `json:"target,omitempty"`
+	Before   *caddy.ServiceConfig `json:"before,omitempty"`
+	After    *caddy.ServiceConfig `json:"after,omitempty"`
+	// Success is false when the operation failed; Error says why.
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Caddy is the Caddy admin API outcome ("ok" or its error message).
+	Caddy string `json:"caddy,omitempty"`
+	// Version is the config history version recorded after the change.
+	Version int `json:"version,omitempty"`
+	Details any `json:"details,omitempty"`
+}
+
+// Filter selects entries in Query. Zero fields match everything.
+type Filter struct {
+	Action string
+	Actor  string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// Limit keeps only the newest Limit matches (0 = all).
+	Limit int
+}
+
+func (f Filter) match(e Entry) bool {
+	switch {
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Target != "" && e.Target != f.Target:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Log is an append-only JSON Lines audit trail. A nil *Log discards
+// everything, so callers need not check whether auditing is configured.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	seq  int64
+}
+
+// Open opens (or creates) the audit file at path and resumes numbering
+// after its last entry.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	l := &Log{path: path}
+	err := l.scan(func(e Entry) {
+		if e.Seq > l.seq {
+			l.seq = e.Seq
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends e, filling in Seq and Time.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Query returns matching entries, oldest first.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	entries := []Entry{}
+	if l == nil {
+		return entries, nil
+	}
+	err := l.scan(func(e Entry) {
+		if f.match(e) {
+			entries = append(entries, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[len(entries)-f.Limit:]
+	}
+	return entries, nil
+}
+
+// Export writes matching entries to w as JSON Lines.
+func (l *Log) Export(w io.Writer, f Filter) error {
+	entries, err := l.Query(f)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan calls fn for every well-formed line of the file.
+func (l *Log) scan(fn func(Entry)) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Scope is the permission level of a token.
+type Scope string
+
+// Scopes, from least to most privileged. Each includes the ones before it.
+const (
+	// ScopeRead may call the read-only dashboard endpoints.
+	ScopeRead Scope = "read"
+	// ScopeRegister may also register, update, heartbeat and deregister
+	// services whose name starts with the token's prefix.
+	ScopeRegister Scope = "register"
+	// ScopeAdmin may do anything, including sync, drift fixes and token
+	// management.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeRank = map[Scope]int{ScopeRead: 1, ScopeRegister: 2, ScopeAdmin: 3}
+
+// Valid reports whether s is a known scope.
+func (s Scope) Valid() bool {
+	return scopeRank[s] > 0
+}
+
+// Allows reports whether s includes required.
+func (s Scope) Allows(required Scope) bool {
+	return scopeRank[s] >= scopeRank[required]
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	TokenID string `json:"tokenId,omitempty"`
+	Name    string `json:"name"`
+	Scope   Scope  `json:"scope"`
+	// Prefix limits a register-scoped token to services named Prefix*.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// CanManage reports whether p may change the named service.
+func (p *Principal) CanManage(service string) bool {
+	switch {
+	case p == nil:
+		return false
+	case p.Scope.Allows(ScopeAdmin):
+		return true
+	case p.Scope.Allows(ScopeRegister):
+		return p.Prefix != "" && strings.HasPrefix(service, p.Prefix)
+	default:
+		return false
+	}
+}
+
+type ctxKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the request's principal, or nil if unauthenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// anonymousAdmin is used for every request when auth is disabled.
+var anonymousAdmin = &Principal{Name: "anonymous", Scope: ScopeAdmin}
+
+// Authenticator checks bearer tokens against the token store and an
+// optional bootstrap admin token.
+type Authenticator struct {
+	tokens    *TokenStore
+	adminHash string
+	oidc      *OIDC
+	disabled  bool
+}
+
+// NewAuthenticator creates an Authenticator. Auth is always enforced,
+// even with no credentials configured, unless Disable is called.
+func NewAuthenticator(tokens *TokenStore, adminToken string) *Authenticator {
+	a := &Authenticator{tokens: tokens}
+	if adminToken != "" {
+		a.adminHash = HashToken(adminToken)
+	}
+	return a
+}
+
+// UseOIDC additionally accepts dashboard session cookies issued by o.
+func (a *Authenticator) UseOIDC(o *OIDC) {
+	a.oidc = o
+}
+
+// Disable treats every caller as admin. It is the explicit opt-out
+// (AUTH_DISABLED=true) for local setups.
+func (a *Authenticator) Disable() {
+	a.disabled = true
+}
+
+// Enabled reports whether requests must carry a token or session.
+func (a *Authenticator) Enabled() bool {
+	return !a.disabled
+}
+
+// HasAdmin reports whether some credential grants admin scope: the
+// bootstrap token, an admin API token or an OIDC role mapping.
+func (a *Authenticator) HasAdmin() bool {
+	return a.adminHash != "" || a.tokens.hasAdmin("") || (a.oidc != nil && a.oidc.grantsAdmin())
+}
+
+// DeleteToken revokes an API token. While auth is enabled it refuses,
+// with ErrLastAdmin, to revoke the only credential that grants admin.
+func (a *Authenticator) DeleteToken(id string) (bool, error) {
+	keepAdmin := a.Enabled() && a.adminHash == "" && (a.oidc == nil || !a.oidc.grantsAdmin())
+	return a.tokens.remove(id, keepAdmin)
+}
+
+// Require wraps next so it only runs for callers holding at least scope.
+func (a *Authenticator) Require(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next(w, r.WithContext(WithPrincipal(r.Context(), anonymousAdmin)))
+			return
+		}
+
+		p, viaCookie := a.authenticate(r)
+		if p == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="caddy-admin"`)
+			body := map[string]string{"error": "missing or invalid token"}
+			if a.oidc != nil {
+				// Tell the dashboard where to send the browser
+				body["login"] = "/api/auth/login"
+			}
+			writeJSONStatus(w, http.StatusUnauthorized, body)
+			return
+		}
+		if viaCookie && !safeMethod(r.Method) && !sameOrigin(r) {
+			writeError(w, http.StatusForbidden, "cross-site request rejected")
+			return
+		}
+		if !p.Scope.Allows(scope) {
+			writeError(w, http.StatusForbidden, "token scope "+string(p.Scope)+" does not allow this ("+string(scope)+" required)")
+			return
+		}
+		next(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+// authenticate resolves the request's bearer token, or failing that its
+// OIDC session cookie, to a principal. viaCookie reports the latter.
+func (a *Authenticator) authenticate(r *http.Request) (p *Principal, viaCookie bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		if a.oidc != nil {
+			if p := a.oidc.principal(r); p != nil {
+				return p, true
+			}
+		}
+		return nil, false
+	}
+	hash := HashToken(strings.TrimSpace(raw))
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(a.adminHash)) == 1 {
+		return &Principal{Name: "bootstrap-admin", Scope: ScopeAdmin}, false
+	}
+	t, ok := a.tokens.Lookup(hash)
+	if !ok {
+		return nil, false
+	}
+	return &Principal{TokenID: t.ID, Name: t.Name, Scope: t.Scope, Prefix: t.Prefix}, false
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether a request comes from a page on the API's own
+// host. Session cookies are SameSite=Lax, so this is what stops another
+// site from submitting a form that mutates with the user's session.
+// Browsers send Origin on every cross-site non-GET request; without it,
+// only an explicit same-origin Sec-Fetch-Site is accepted.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") == "same-origin"
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// HashToken returns the hex SHA-256 of a plaintext token. Tokens are
+// random and long, so a fast unsalted hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Me handles GET /api/auth/me
+func Me(w http.ResponseWriter, r *http.Request) {
+	writeJSONStatus(w, http.StatusOK, FromContext(r.Context()))
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSONStatus(w, code, map[string]string{"error": msg})
+}
+
+func writeJSONStatus(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
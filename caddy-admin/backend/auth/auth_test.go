@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func newTestTokens(t *testing.T) *TokenStore {
+	t.Helper()
+	ts, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func call(a *Authenticator, token string) int {
+	h := a.Require(ScopeRead, func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodGet, "/api/sites", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Code
+}
+
+func TestRequireFailsClosed(t *testing.T) {
+	a := NewAuthenticator(newTestTokens(t), "")
+	if code := call(a, ""); code != http.StatusUnauthorized {
+		t.Errorf("no credentials configured: status %d, want 401", code)
+	}
+
+	a.Disable()
+	if code := call(a, ""); code != http.StatusOK {
+		t.Errorf("AUTH_DISABLED: status %d, want 200", code)
+	}
+}
+
+func TestRequireAfterLastTokenDeleted(t *testing.T) {
+	ts := newTestTokens(t)
+	a := NewAuthenticator(ts, "")
+	secret, tok, err := ts.Create("reader", ScopeRead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := call(a, secret); code != http.StatusOK {
+		t.Fatalf("valid token: status %d", code)
+	}
+	if _, err := a.DeleteToken(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := call(a, ""); code != http.StatusUnauthorized {
+		t.Errorf("after deleting the last token: status %d, want 401", code)
+	}
+}
+
+func TestDeleteTokenKeepsLastAdmin(t *testing.T) {
+	ts := newTestTokens(t)
+	a := NewAuthenticator(ts, "")
+	_, first, _ := ts.Create("ops", ScopeAdmin, "")
+	_, reader, _ := ts.Create("dash", ScopeRead, "")
+
+	if _, err := a.DeleteToken(first.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("deleting the only admin token: err = %v, want ErrLastAdmin", err)
+	}
+	if !a.HasAdmin() {
+		t.Fatal("admin token was removed")
+	}
+	if ok, err := a.DeleteToken(reader.ID); !ok || err != nil {
+		t.Errorf("deleting a read token: %v, %v", ok, err)
+	}
+
+	_, second, _ := ts.Create("ops2", ScopeAdmin, "")
+	if ok, err := a.DeleteToken(first.ID); !ok || err != nil {
+		t.Fatalf("deleting one of two admin tokens: %v, %v", ok, err)
+	}
+	if _, err := a.DeleteToken(second.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("deleting the remaining admin token: err = %v, want ErrLastAdmin", err)
+	}
+
+	// The bootstrap token is an admin credential of its own.
+	b := NewAuthenticator(ts, "bootstrap")
+	if ok, err := b.DeleteToken(second.ID); !ok || err != nil {
+		t.Errorf("with ADMIN_TOKEN set: %v, %v", ok, err)
+	}
+}
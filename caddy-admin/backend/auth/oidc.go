@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Cookie names used by the OIDC login flow.
+const (
+	SessionCookie = "cadm_session"
+	flowCookie    = "cadm_oidc"
+)
+
+// OIDCConfig configures the dashboard's OpenID Connect login.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // empty for public clients; PKCE is always used
+	RedirectURL  string // e.g. https://caddy-admin.example.com/api/auth/callback
+	Scopes       []string
+	// GroupsClaim is the ID token claim holding the user's groups.
+	GroupsClaim string
+	// RoleMap maps a group to a role: "read", "admin" or "register:<prefix>".
+	// A user gets the most privileged role among their groups.
+	RoleMap map[string]string
+	// DefaultRole applies to users in no mapped group; empty denies login.
+	DefaultRole string
+	SessionTTL  time.Duration
+	// SecureCookies should be true whenever the dashboard is served over HTTPS.
+	SecureCookies bool
+}
+
+// ParseRoleMap parses "group=role,group2=role2".
+func ParseRoleMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("role map entry %q must be group=role", pair)
+		}
+		if _, _, err := parseRole(role); err != nil {
+			return nil, err
+		}
+		m[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+	return m, nil
+}
+
+// ValidateRole checks a role string such as "admin" or "register:proj-".
+func ValidateRole(role string) error {
+	_, _, err := parseRole(role)
+	return err
+}
+
+// grantsAdmin reports whether some user can sign in with admin scope.
+func (o *OIDC) grantsAdmin() bool {
+	roles := []string{o.cfg.DefaultRole}
+	for _, role := range o.cfg.RoleMap {
+		roles = append(roles, role)
+	}
+	for _, role := range roles {
+		if scope, _, err := parseRole(role); err == nil && scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRole splits "register:<prefix>" and validates the scope.
+func parseRole(role string) (Scope, string, error) {
+	scope, prefix, _ := strings.Cut(strings.TrimSpace(role), ":")
+	s := Scope(scope)
+	if !s.Valid() {
+		return "", "", fmt.Errorf("unknown role %q (want read, admin or register:<prefix>)", role)
+	}
+	if s == ScopeRegister && prefix == "" {
+		return "", "", fmt.Errorf("role %q needs a prefix, e.g. register:project-", role)
+	}
+	return s, prefix, nil
+}
+
+// session is the payload of the session cookie.
+type session struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name"`
+	Scope   Scope  `json:"scope"`
+	Prefix  string `json:"prefix,omitempty"`
+}
+
+// flowState is kept in a short-lived cookie between login and callback.
+type flowState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"returnTo"`
+}
+
+// OIDC is an OpenID Connect relying party using the authorization code
+// flow with PKCE. Provider discovery happens on first use, so caddy-admin
+// can start before the issuer is reachable.
+type OIDC struct {
+	cfg    OIDCConfig
+	signer *Signer
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC creates the relying party. signer signs the session cookies.
+func NewOIDC(cfg OIDCConfig, signer *Signer) *OIDC {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email", "groups"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 8 * time.Hour
+	}
+	return &OIDC{cfg: cfg, signer: signer}
+}
+
+// discover fetches the issuer's metadata once. ctx may carry a custom
+// *http.Client via oidc.ClientContext.
+func (o *OIDC) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.oauth != nil {
+		return o.oauth, o.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, o.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	o.oauth = &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		RedirectURL:  o.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       o.cfg.Scopes,
+	}
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.cfg.ClientID})
+	return o.oauth, o.verifier, nil
+}
+
+// Login handles GET /api/auth/login[?return=/path]
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	oauth, _, err := o.discover(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	flow := flowState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: safeReturnPath(r.URL.Query().Get("return")),
+	}
+	if err := o.signer.SetCookie(w, flowCookie, flow, 10*time.Minute, o.cfg.SecureCookies); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	url := oauth.AuthCodeURL(flow.State,
+		oidc.Nonce(flow.Nonce),
+		oauth2.S256ChallengeOption(flow.Verifier),
+	)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Callback handles GET /api/auth/callback
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	oauth, verifier, err := o.discover(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	var flow flowState
+	if err := o.signer.ReadCookie(r, flowCookie, &flow); err != nil {
+		writeError(w, http.StatusBadRequest, "login flow expired, start again")
+		return
+	}
+	ClearCookie(w, flowCookie)
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "identity provider: "+e+" "+q.Get("error_description"))
+		return
+	}
+	if q.Get("state") != flow.State {
+		writeError(w, http.StatusBadRequest, "state mismatch")
+		return
+	}
+
+	tok, err := oauth.Exchange(r.Context(), q.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "code exchange failed: "+err.Error())
+		return
+	}
+	rawID, ok := tok.Extra("id_token").(string)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "no id_token in token response")
+		return
+	}
+	idToken, err := verifier.Verify(r.Context(), rawID)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "id_token invalid: "+err.Error())
+		return
+	}
+	if idToken.Nonce != flow.Nonce {
+		writeError(w, http.StatusUnauthorized, "nonce mismatch")
+		return
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		writeError(w, http.StatusUnauthorized, "claims: "+err.Error())
+		return
+	}
+	sess, ok := o.sessionFor(idToken.Subject, claims)
+	if !ok {
+		writeError(w, http.StatusForbidden, "your groups are not mapped to any caddy-admin role")
+		return
+	}
+	if err := o.signer.SetCookie(w, SessionCookie, sess, o.cfg.SessionTTL, o.cfg.SecureCookies); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("oidc: %s logged in as %s", sess.Name, sess.Scope)
+	http.Redirect(w, r, flow.ReturnTo, http.StatusFound)
+}
+
+// Logout handles POST /api/auth/logout
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) {
+	ClearCookie(w, SessionCookie)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sessionFor maps the user's groups to the most privileged role.
+func (o *OIDC) sessionFor(subject string, claims map[string]any) (session, bool) {
+	sess := session{Subject: subject, Name: subject}
+	for _, k := range []string{"email", "preferred_username", "name"} {
+		if v, ok := claims[k].(string); ok && v != "" {
+			sess.Name = v
+			break
+		}
+	}
+
+	roles := []string{}
+	if o.cfg.DefaultRole != "" {
+		roles = append(roles, o.cfg.DefaultRole)
+	}
+	for _, g := range stringList(claims[o.cfg.GroupsClaim]) {
+		if role, ok := o.cfg.RoleMap[g]; ok {
+			roles = append(roles, role)
+		}
+	}
+	for _, role := range roles {
+		scope, prefix, err := parseRole(role)
+		if err != nil {
+			continue
+		}
+		if sess.Scope == "" || (scope.Allows(sess.Scope) && scope != sess.Scope) {
+			sess.Scope, sess.Prefix = scope, prefix
+		}
+	}
+	return sess, sess.Scope != ""
+}
+
+// principal returns the principal of a valid session cookie, or nil.
+func (o *OIDC) principal(r *http.Request) *Principal {
+	var sess session
+	if err := o.signer.ReadCookie(r, SessionCookie, &sess); err != nil {
+		return nil
+	}
+	return &Principal{Name: sess.Name, Scope: sess.Scope, Prefix: sess.Prefix}
+}
+
+// stringList accepts a claim that is a string or a list of strings.
+func stringList(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, x := range t {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// safeReturnPath only allows local absolute paths, to avoid open redirects.
+func safeReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, "\\") {
+		return "/"
+	}
+	return p
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier against the challenge sent at
+// login.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is what the provider remembers about an authorization code.
+type grant struct {
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, codes: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "alg": "RS256", "use": "sig",
+			"n": b64(key.N.Bytes()),
+			"e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize issues code as if the user had signed in with claims.
+func (m *mockIssuer) authorize(code, challenge, nonce string, claims map[string]any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = grant{challenge: challenge, nonce: nonce, claims: claims}
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	g, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || b64(sum[:]) != g.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   m.URL,
+		"sub":   "user-1",
+		"aud":   "caddy-admin",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     m.sign(claims),
+	})
+}
+
+func (m *mockIssuer) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	sum := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	return input + "." + b64(sig)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func newTestOIDC(issuer string) *OIDC {
+	return NewOIDC(OIDCConfig{
+		IssuerURL:   issuer,
+		ClientID:    "caddy-admin",
+		RedirectURL: "https://admin.test/api/auth/callback",
+		RoleMap:     map[string]string{"ops": "admin", "dev": "read"},
+	}, NewSigner([]byte("0123456789abcdef0123456789abcdef")))
+}
+
+func cookieFrom(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name && c.MaxAge >= 0 {
+			return c
+		}
+	}
+	t.Fatalf("no %s cookie in response", name)
+	return nil
+}
+
+// login starts the flow and returns the flow cookie and the
+// authorization request's query.
+func login(t *testing.T, o *OIDC) (*http.Cookie, url.Values) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	o.Login(w, httptest.NewRequest(http.MethodGet, "/api/auth/login?return=/services", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookieFrom(t, w, flowCookie), loc.Query()
+}
+
+func callback(o *OIDC, flow *http.Cookie, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/callback?"+query, nil)
+	if flow != nil {
+		r.AddCookie(flow)
+	}
+	w := httptest.NewRecorder()
+	o.Callback(w, r)
+	return w
+}
+
+func TestOIDCLoginPKCERoundTrip(t *testing.T) {
+	idp := newMockIssuer(t)
+	o := newTestOIDC(idp.URL)
+
+	flow, q := login(t, o)
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without S256 PKCE: %v", q)
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" {
+		t.Fatalf("authorization request without state or nonce: %v", q)
+	}
+	idp.authorize("code-1", q.Get("code_challenge"), q.Get("nonce"), map[string]any{
+		"email":  "alice@example.com",
+		"groups": []string{"dev", "ops"},
+	})
+
+	w := callback(o, flow, "code=code-1&state="+url.QueryEscape(q.Get("state")))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/services" {
+		t.Fatalf("callback: status %d, location %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	r.AddCookie(cookieFrom(t, w, SessionCookie))
+	p := o.principal(r)
+	if p == nil || p.Name != "alice@example.com" || p.Scope != ScopeAdmin {
+		t.Errorf("session principal = %+v, want alice@example.com as admin", p)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	idp := newMockIssuer(t)
+	o := newTestOIDC(idp.URL)
+
+	t.Run("state mismatch", func(t *testing.T) {
+		flow, q := login(t, o)
+		idp.authorize("code-2", q.Get("code_challenge"), q.Get("nonce"), nil)
+		if w := callback(o, flow, "code=code-2&state=forged"); w.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		// A code issued for another login's challenge cannot be redeemed
+		// with this flow's verifier.
+		flow, q := login(t, o)
+		_, other := login(t, o)
+		idp.authorize("code-3", other.Get("code_challenge"), q.Get("nonce"), nil)
+		if w := callback(o, flow, "code=code-3&state="+url.QueryEscape(q.Get("state"))); w.Code != http.StatusUnauthorized {
+			t.Errorf("status %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		flow, q := login(t, o)
+		idp.authorize("code-4", q.Get("code_challenge"), "replayed", nil)
+		if w := callback(o, flow, "code=code-4&state="+url.QueryEscape(q.Get("state"))); w.Code != http.StatusUnauthorized {
+			t.Errorf("status %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("tampered flow cookie", func(t *testing.T) {
+		flow, q := login(t, o)
+		idp.authorize("code-5", q.Get("code_challenge"), q.Get("nonce"), map[string]any{"groups": []string{"ops"}})
+		flow.Value = tamper(t, flow.Value, func(m map[string]any) { m["verifier"] = "attacker-verifier" })
+		if w := callback(o, flow, "code=code-5&state="+url.QueryEscape(q.Get("state"))); w.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", w.Code)
+		}
+	})
+}
+
+// tamper rewrites the payload of a signed cookie value, keeping the old
+// signature.
+func tamper(t *testing.T, value string, edit func(map[string]any)) string {
+	t.Helper()
+	body, sig, _ := strings.Cut(value, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env struct {
+		Exp  int64          `json:"exp"`
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &env); err != nil {
+		t.Fatal(err)
+	}
+	edit(env.Data)
+	payload, _ = json.Marshal(env)
+	return b64(payload) + "." + sig
+}
+
+func TestSessionCookieSignature(t *testing.T) {
+	o := newTestOIDC("http://unused.test")
+	w := httptest.NewRecorder()
+	if err := o.signer.SetCookie(w, SessionCookie, session{Subject: "u", Name: "bob", Scope: ScopeRead}, time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+	c := cookieFrom(t, w, SessionCookie)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	if p := o.principal(r); p == nil || p.Scope != ScopeRead {
+		t.Fatalf("valid cookie: principal %+v", p)
+	}
+
+	forged := *c
+	forged.Value = tamper(t, c.Value, func(m map[string]any) { m["scope"] = "admin" })
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&forged)
+	if p := o.principal(r); p != nil {
+		t.Errorf("tampered cookie accepted as %+v", p)
+	}
+
+	other := NewSigner([]byte("another-key-another-key-another-k"))
+	value, _ := other.Encode(session{Name: "mallory", Scope: ScopeAdmin}, time.Hour)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: value})
+	if p := o.principal(r); p != nil {
+		t.Errorf("cookie signed with another key accepted as %+v", p)
+	}
+
+	expired, _ := o.signer.Encode(session{Name: "bob", Scope: ScopeRead}, -time.Minute)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: expired})
+	if p := o.principal(r); p != nil {
+		t.Errorf("expired cookie accepted as %+v", p)
+	}
+}
+
+func TestSessionForRoleMapping(t *testing.T) {
+	cfg := OIDCConfig{
+		RoleMap: map[string]string{"ops": "admin", "dev": "read", "team-c": "register:project-c"},
+	}
+	tests := []struct {
+		name        string
+		defaultRole string
+		groups      any
+		scope       Scope
+		prefix      string
+	}{
+		{"read group", "", []any{"dev"}, ScopeRead, ""},
+		{"highest role wins", "", []any{"dev", "ops"}, ScopeAdmin, ""},
+		{"register prefix", "", []any{"team-c"}, ScopeRegister, "project-c"},
+		{"register beats read", "", []any{"dev", "team-c"}, ScopeRegister, "project-c"},
+		{"single string claim", "", "ops", ScopeAdmin, ""},
+		{"unmapped group denied", "", []any{"sales"}, "", ""},
+		{"no groups denied", "", nil, "", ""},
+		{"default role", "read", []any{"sales"}, ScopeRead, ""},
+		{"mapped group beats default", "read", []any{"ops"}, ScopeAdmin, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			c.DefaultRole = tt.defaultRole
+			o := NewOIDC(c, nil)
+			claims := map[string]any{"email": "u@example.com"}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			sess, ok := o.sessionFor("sub", claims)
+			if ok != (tt.scope != "") || sess.Scope != tt.scope || sess.Prefix != tt.prefix {
+				t.Errorf("got %q %q ok=%v, want %q %q", sess.Scope, sess.Prefix, ok, tt.scope, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestCookieSessionRequiresSameOrigin(t *testing.T) {
+	o := newTestOIDC("http://unused.test")
+	a := NewAuthenticator(newTestTokens(t), "bootstrap")
+	a.UseOIDC(o)
+	value, _ := o.signer.Encode(session{Name: "alice", Scope: ScopeAdmin}, time.Hour)
+	h := a.Require(ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(method, origin string, cookie bool) int {
+		r := httptest.NewRequest(method, "https://admin.test/api/services/drift", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if cookie {
+			r.AddCookie(&http.Cookie{Name: SessionCookie, Value: value})
+		} else {
+			r.Header.Set("Authorization", "Bearer bootstrap")
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		cookie bool
+		want   int
+	}{
+		{"cookie GET", http.MethodGet, "", true, http.StatusOK},
+		{"cookie POST same origin", http.MethodPost, "https://admin.test", true, http.StatusOK},
+		{"cookie POST cross site", http.MethodPost, "https://evil.test", true, http.StatusForbidden},
+		{"cookie POST without origin", http.MethodPost, "", true, http.StatusForbidden},
+		{"bearer POST without origin", http.MethodPost, "", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := do(tt.method, tt.origin, tt.cookie); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
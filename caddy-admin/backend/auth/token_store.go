@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Token is a stored API token. Only the SHA-256 of the secret is kept.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scope     Scope     `json:"scope"`
+	Prefix    string    `json:"prefix,omitempty"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TokenStore persists tokens to a JSON file and keeps them indexed by hash.
+type TokenStore struct {
+	mu     sync.RWMutex
+	path   string
+	tokens []Token
+}
+
+// NewTokenStore loads tokens from path. A missing file is an empty store.
+func NewTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ts, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ts.tokens); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// List returns all tokens.
+func (ts *TokenStore) List() []Token {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return append([]Token(nil), ts.tokens...)
+}
+
+// Len returns the number of tokens.
+func (ts *TokenStore) Len() int {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return len(ts.tokens)
+}
+
+// Lookup finds a token by the hash of its secret.
+func (ts *TokenStore) Lookup(hash string) (Token, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, t := range ts.tokens {
+		if t.Hash == hash {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// Create generates a new token and returns its plaintext secret, which is
+// not recoverable afterwards.
+func (ts *TokenStore) Create(name string, scope Scope, prefix string) (string, Token, error) {
+	if !scope.Valid() {
+		return "", Token{}, errors.New("scope must be read, register or admin")
+	}
+	if scope == ScopeRegister && prefix == "" {
+		return "", Token{}, errors.New("register tokens require a prefix")
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Token{}, err
+	}
+	plaintext := "cadm_" + secret
+
+	t := Token{
+		ID:        id,
+		Name:      name,
+		Scope:     scope,
+		Prefix:    prefix,
+		Hash:      HashToken(plaintext),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tokens := append(append([]Token(nil), ts.tokens...), t)
+	if err := ts.save(tokens); err != nil {
+		return "", Token{}, err
+	}
+	ts.tokens = tokens
+	return plaintext, t, nil
+}
+
+// ErrLastAdmin is returned when revoking a token would leave no
+// credential with admin scope.
+var ErrLastAdmin = errors.New("cannot revoke the last admin credential; create another admin token or set ADMIN_TOKEN first")
+
+// Delete revokes a token by ID and reports whether it existed.
+func (ts *TokenStore) Delete(id string) (bool, error) {
+	return ts.remove(id, false)
+}
+
+// remove revokes a token by ID. With keepAdmin it fails with ErrLastAdmin
+// instead of removing the only admin-scoped token.
+func (ts *TokenStore) remove(id string, keepAdmin bool) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var kept []Token
+	var removed Token
+	for _, t := range ts.tokens {
+		if t.ID != id {
+			kept = append(kept, t)
+		} else {
+			removed = t
+		}
+	}
+	if len(kept) == len(ts.tokens) {
+		return false, nil
+	}
+	if keepAdmin && removed.Scope == ScopeAdmin && !ts.hasAdminLocked(id) {
+		return false, ErrLastAdmin
+	}
+	if err := ts.save(kept); err != nil {
+		return false, err
+	}
+	ts.tokens = kept
+	return true, nil
+}
+
+// hasAdmin reports whether an admin-scoped token other than except exists.
+func (ts *TokenStore) hasAdmin(except string) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.hasAdminLocked(except)
+}
+
+func (ts *TokenStore) hasAdminLocked(except string) bool {
+	for _, t := range ts.tokens {
+		if t.ID != except && t.Scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *TokenStore) save(tokens []Token) error {
+	if tokens == nil {
+		tokens = []Token{}
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0755); err != nil {
+		return err
+	}
+	tmp := ts.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ts.path)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
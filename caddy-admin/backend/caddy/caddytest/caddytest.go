@@ -0,0 +1,262 @@
+// Package caddytest provides an in-memory fake of the Caddy admin API for
+// tests. It implements the endpoints the caddy package uses: GET /config/,
+// POST /load, the routes list of each HTTP server and /id/<id>.
+package caddytest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DefaultConfig has one HTTPS server with a static site.
+const DefaultConfig = `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"],"routes":[
+	{"match":[{"host":["static.test"]}],"handle":[{"handler":"file_server"}]}]}}}}}`
+
+// Server is a fake Caddy admin API.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	cfg    map[string]any
+	fail   []failure
+	loads  []http.Header
+	counts map[string]int
+	trail  []string
+}
+
+type failure struct{ method, prefix string }
+
+// NewServer starts a fake admin API holding cfg (DefaultConfig if empty)
+// and closes it when the test ends.
+func NewServer(t testing.TB, cfg string) *Server {
+	t.Helper()
+	if cfg == "" {
+		cfg = DefaultConfig
+	}
+	s := &Server{counts: map[string]int{}}
+	if err := json.Unmarshal([]byte(cfg), &s.cfg); err != nil {
+		t.Fatalf("caddytest: parse config: %v", err)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr is the host:port to pass to caddy.NewClient.
+func (s *Server) Addr() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// FailOn makes every request with method whose path starts with prefix
+// answer 500 until Recover is called. Method "" matches any method.
+func (s *Server) FailOn(method, prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = append(s.fail, failure{method, prefix})
+}
+
+// Recover clears every FailOn.
+func (s *Server) Recover() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = nil
+}
+
+// Config returns the current config as JSON.
+func (s *Server) Config() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, _ := json.Marshal(s.cfg)
+	return string(data)
+}
+
+// RouteIDs returns the @id of every route of server, "" for routes
+// without one.
+func (s *Server) RouteIDs(server string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	srv, _ := s.servers()[server].(map[string]any)
+	routes, _ := srv["routes"].([]any)
+	for _, r := range routes {
+		id, _ := r.(map[string]any)["@id"].(string)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Loads returns the headers of every POST /load received.
+func (s *Server) Loads() []http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]http.Header(nil), s.loads...)
+}
+
+// Trail returns the config as JSON after every successful change, oldest
+// first.
+func (s *Server) Trail() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.trail...)
+}
+
+// Count returns how many requests with method were received, failed
+// ones included.
+func (s *Server) Count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[method]
+}
+
+func (s *Server) servers() map[string]any {
+	apps, _ := s.cfg["apps"].(map[string]any)
+	app, _ := apps["http"].(map[string]any)
+	servers, _ := app["servers"].(map[string]any)
+	return servers
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[r.Method]++
+	for _, f := range s.fail {
+		if (f.method == "" || f.method == r.Method) && strings.HasPrefix(r.URL.Path, f.prefix) {
+			http.Error(w, `{"error":"injected failure"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if r.Method != http.MethodGet {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		defer func() {
+			if rec.code < 400 {
+				data, _ := json.Marshal(s.cfg)
+				s.trail = append(s.trail, string(data))
+			}
+		}()
+		w = rec
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var value any
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &value); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/config/" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(s.cfg)
+	case path == "/load" && r.Method == http.MethodPost:
+		cfg, ok := value.(map[string]any)
+		if !ok {
+			http.Error(w, `{"error":"config must be an object"}`, http.StatusBadRequest)
+			return
+		}
+		s.cfg = cfg
+		s.loads = append(s.loads, r.Header.Clone())
+	case path == "/reverse_proxy/upstreams":
+		w.Write([]byte("[]"))
+	case strings.HasPrefix(path, "/config/apps/http/servers/"):
+		s.serveRoutes(w, r, strings.TrimPrefix(path, "/config/apps/http/servers/"), value)
+	case strings.HasPrefix(path, "/id/"):
+		s.serveID(w, r, strings.TrimPrefix(path, "/id/"), value)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveRoutes handles <server>/routes[/<index>] with Caddy's semantics:
+// PUT on the list creates it, POST appends, PUT on an index inserts
+// before it, PATCH on an index replaces and DELETE removes.
+func (s *Server) serveRoutes(w http.ResponseWriter, r *http.Request, rest string, value any) {
+	parts := strings.Split(rest, "/")
+	srv, ok := s.servers()[parts[0]].(map[string]any)
+	if !ok || len(parts) < 2 || parts[1] != "routes" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	routes, exists := srv["routes"].([]any)
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(routes)
+		case http.MethodPut:
+			if exists {
+				http.Error(w, `{"error":"key already exists"}`, http.StatusConflict)
+				return
+			}
+			srv["routes"] = value
+		case http.MethodPost:
+			srv["routes"] = append(routes, value)
+		case http.MethodPatch:
+			srv["routes"] = value
+		default:
+			http.Error(w, "", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	i, err := strconv.Atoi(parts[2])
+	if err != nil || i < 0 || i > len(routes) || (i == len(routes) && r.Method != http.MethodPut) {
+		http.Error(w, `{"error":"invalid index"}`, http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(routes[i])
+	case http.MethodPut:
+		out := append(append(append([]any{}, routes[:i]...), value), routes[i:]...)
+		srv["routes"] = out
+	case http.MethodPatch:
+		routes[i] = value
+	case http.MethodDelete:
+		srv["routes"] = append(append([]any{}, routes[:i]...), routes[i+1:]...)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveID handles /id/<id> for top-level routes.
+func (s *Server) serveID(w http.ResponseWriter, r *http.Request, id string, value any) {
+	for _, v := range s.servers() {
+		srv, _ := v.(map[string]any)
+		routes, _ := srv["routes"].([]any)
+		for i, route := range routes {
+			if rid, _ := route.(map[string]any)["@id"].(string); rid != id {
+				continue
+			}
+			switch r.Method {
+			case http.MethodGet:
+				json.NewEncoder(w).Encode(route)
+			case http.MethodPatch:
+				routes[i] = value
+			case http.MethodDelete:
+				srv["routes"] = append(append([]any{}, routes[:i]...), routes[i+1:]...)
+			default:
+				http.Error(w, "", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+	}
+	http.Error(w, `{"error":"unknown object ID '`+id+`'"}`, http.StatusNotFound)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,98 @@
+package caddy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// ChainCert is an intermediate certificate bundled with a leaf.
+type ChainCert struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	Serial             string    `json:"serial"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DaysLeft           int       `json:"daysLeft"`
+	IsExpired          bool      `json:"isExpired"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	Fingerprint        string    `json:"fingerprint"`
+}
+
+// newCertInfo describes chain[0] and the intermediates after it.
+func newCertInfo(domain, source string, chain []*x509.Certificate) CertInfo {
+	leaf := chain[0]
+	daysLeft := daysUntil(leaf.NotAfter)
+	info := CertInfo{
+		Domain:             domain,
+		Issuer:             leaf.Issuer.CommonName,
+		NotBefore:          leaf.NotBefore,
+		NotAfter:           leaf.NotAfter,
+		DaysLeft:           daysLeft,
+		IsExpired:          daysLeft < 0,
+		Source:             source,
+		SANs:               certSANs(leaf),
+		Serial:             leaf.SerialNumber.Text(16),
+		SignatureAlgorithm: leaf.SignatureAlgorithm.String(),
+		Fingerprint:        Fingerprint(leaf),
+		Chain:              []ChainCert{},
+	}
+	info.KeyType, info.KeySize = publicKeyInfo(leaf)
+	for _, c := range chain[1:] {
+		days := daysUntil(c.NotAfter)
+		info.Chain = append(info.Chain, ChainCert{
+			Subject:            c.Subject.CommonName,
+			Issuer:             c.Issuer.CommonName,
+			Serial:             c.SerialNumber.Text(16),
+			NotBefore:          c.NotBefore,
+			NotAfter:           c.NotAfter,
+			DaysLeft:           days,
+			IsExpired:          days < 0,
+			SignatureAlgorithm: c.SignatureAlgorithm.String(),
+			Fingerprint:        Fingerprint(c),
+		})
+	}
+	return info
+}
+
+// Fingerprint returns the lowercase hex SHA-256 of the DER certificate.
+func Fingerprint(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint lowercases fp and drops ":" separators, so the
+// "AB:CD:..." form shown by browsers and openssl matches too.
+func NormalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+func daysUntil(t time.Time) int {
+	return int(time.Until(t).Hours() / 24)
+}
+
+func certSANs(c *x509.Certificate) []string {
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+func publicKeyInfo(c *x509.Certificate) (string, int) {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return c.PublicKeyAlgorithm.String(), 0
+	}
+}
@@ -3,16 +3,25 @@ package caddy
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 )
 
+// ErrRouteNotFound is returned when no route with the requested @id exists.
+var ErrRouteNotFound = errors.New("route not found")
+
 // Client queries the Caddy Admin API
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	// server, if set, is the HTTP server new routes are added to unless a
+	// service names its own.
+	server string
+	// registry loads the stored services for route ordering.
+	registry func() ([]ServiceConfig, error)
 }
 
 // NewClient creates a new Caddy Admin API client.
@@ -26,8 +35,28 @@ func NewClient(adminAddr string) *Client {
 	}
 }
 
+// UseServer makes routes go to the named HTTP server instead of the one
+// chosen by listen port.
+func (c *Client) UseServer(name string) {
+	c.server = name
+}
+
 // GetConfig fetches the full Caddy config from /config/
 func (c *Client) GetConfig() (*CaddyConfig, error) {
+	body, err := c.GetConfigRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg CaddyConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// GetConfigRaw fetches the /config/ document as returned by Caddy.
+func (c *Client) GetConfigRaw() ([]byte, error) {
 	resp, err := c.httpClient.Get(c.baseURL + "/config/")
 	if err != nil {
 		return nil, fmt.Errorf("caddy admin api unreachable: %w", err)
@@ -38,12 +67,35 @@ func (c *Client) GetConfig() (*CaddyConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caddy returned %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
 
-	var cfg CaddyConfig
-	if err := json.Unmarshal(body, &cfg); err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+// GetUpstreams fetches per-upstream request and fail counts from
+// /reverse_proxy/upstreams. Only upstreams of reverse_proxy handlers
+// currently in the config are listed.
+func (c *Client) GetUpstreams() ([]UpstreamStatus, error) {
+	resp, err := c.httpClient.Get(c.baseURL + "/reverse_proxy/upstreams")
+	if err != nil {
+		return nil, fmt.Errorf("caddy admin api unreachable: %w", err)
 	}
-	return &cfg, nil
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caddy returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var upstreams []UpstreamStatus
+	if err := json.Unmarshal(body, &upstreams); err != nil {
+		return nil, fmt.Errorf("parse upstreams: %w", err)
+	}
+	return upstreams, nil
 }
 
 // IsRunning returns true if Caddy admin API is reachable
@@ -56,13 +108,114 @@ func (c *Client) IsRunning() bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-// AddRoute prepends a route to srv0's route list.
-func (c *Client) AddRoute(routeJSON json.RawMessage) error {
-	url := c.baseURL + "/config/apps/http/servers/srv0/routes/0"
-	_, err := c.do(http.MethodPut, url, routeJSON)
+// LoadConfig replaces Caddy's entire config via POST /load. Caddy
+// applies it atomically and keeps the old config if it fails to load.
+func (c *Client) LoadConfig(raw json.RawMessage) error {
+	resp, err := c.do(http.MethodPost, c.baseURL+"/load", raw)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("caddy returned 404 for /load")
+	}
+	return nil
+}
+
+// Reload makes Caddy re-provision its current config, which re-reads
+// files such as certificates loaded with `tls <cert> <key>`. Caddy skips
+// loading an unchanged config unless the request asks to revalidate. The
+// reload is graceful: existing connections are not dropped.
+func (c *Client) Reload() error {
+	raw, err := c.GetConfigRaw()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/load", bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cache-Control", "must-revalidate")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("caddy admin api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("caddy returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// AddRoute inserts the service's route into its server (see
+// HTTPApp.SelectServer) at the position given by routePlan: in priority
+// order among svc-* routes and ahead of any other route that would catch
+// the same host, such as a wildcard catch-all.
+func (c *Client) AddRoute(svc ServiceConfig) error {
+	app, err := c.httpApp()
+	if err != nil {
+		return err
+	}
+	p, err := c.planRoute(app, svc)
+	if err != nil {
+		return err
+	}
+	return c.insertRoute(app, p, svc)
+}
+
+func (c *Client) insertRoute(app HTTPApp, p routePlan, svc ServiceConfig) error {
+	return c.insertAt(app, p.server, p.index, BuildCaddyRoute(svc))
+}
+
+// insertAt puts route before index in server's routes, or last.
+func (c *Client) insertAt(app HTTPApp, server string, index int, route json.RawMessage) error {
+	count := len(app.Servers[server].Routes)
+	base := c.baseURL + "/config/apps/http/servers/" + server + "/routes"
+
+	var err error
+	switch {
+	case count == 0:
+		_, err = c.do(http.MethodPut, base, json.RawMessage("["+string(route)+"]"))
+	case index >= count:
+		_, err = c.do(http.MethodPost, base, route) // append
+	default:
+		_, err = c.do(http.MethodPut, fmt.Sprintf("%s/%d", base, index), route) // insert before index
+	}
 	return err
 }
 
+// UseRegistry gives the client the stored services, whose priorities
+// decide the order of svc-* routes. Without it every route has priority 0.
+func (c *Client) UseRegistry(load func() ([]ServiceConfig, error)) {
+	c.registry = load
+}
+
+// peers returns the stored services by name.
+func (c *Client) peers() (map[string]ServiceConfig, error) {
+	peers := make(map[string]ServiceConfig)
+	if c.registry == nil {
+		return peers, nil
+	}
+	services, err := c.registry()
+	if err != nil {
+		return nil, fmt.Errorf("load services for route order: %w", err)
+	}
+	for _, svc := range services {
+		peers[svc.Name] = svc
+	}
+	return peers, nil
+}
+
+func (c *Client) httpApp() (HTTPApp, error) {
+	cfg, err := c.GetConfig()
+	if err != nil {
+		return HTTPApp{}, err
+	}
+	return cfg.HTTP()
+}
+
 // RemoveRoute deletes a route by its @id. 404 is treated as success.
 func (c *Client) RemoveRoute(name string) error {
 	url := c.baseURL + "/id/svc-" + name
@@ -76,11 +229,143 @@ func (c *Client) RemoveRoute(name string) error {
 	return nil
 }
 
-// UpsertRoute removes then adds a route for the given service.
+// ReplaceRoute swaps the route with @id svc-<name> in place via PATCH.
+// Caddy applies the change atomically: on failure the old route stays.
+// Returns ErrRouteNotFound if the route does not exist yet.
+func (c *Client) ReplaceRoute(svc ServiceConfig) error {
+	url := c.baseURL + "/id/svc-" + svc.Name
+	resp, err := c.do(http.MethodPatch, url, BuildCaddyRoute(svc))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrRouteNotFound
+	}
+	return nil
+}
+
+// UpsertRoute replaces the service's route in place, or adds it if absent.
+// A route that has to move, to another server or to keep svc-* routes in
+// order after a priority, host or path change, is moved by moveRoute.
 func (c *Client) UpsertRoute(svc ServiceConfig) error {
-	_ = c.RemoveRoute(svc.Name)
-	route := BuildCaddyRoute(svc)
-	return c.AddRoute(route)
+	app, err := c.httpApp()
+	if err != nil {
+		return err
+	}
+	p, err := c.planRoute(app, svc)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.inPlace():
+		err := c.ReplaceRoute(svc)
+		if !errors.Is(err, ErrRouteNotFound) {
+			return err
+		}
+		// Removed since we read the config; add it back.
+		if app, err = c.httpApp(); err != nil {
+			return err
+		}
+		if p, err = c.planRoute(app, svc); err != nil {
+			return err
+		}
+		return c.insertRoute(app, p, svc)
+	case p.current == "":
+		return c.insertRoute(app, p, svc)
+	default:
+		return c.moveRoute(app, p, svc)
+	}
+}
+
+// movingRoutePrefix marks the @id of a route being moved. It is not a
+// ServiceRoutePrefix, so drift checks never mistake it for a service.
+const movingRoutePrefix = "moving-svc-"
+
+// moveRoute puts svc's route at p without a moment where neither the old
+// nor the new route serves the service: the new route is inserted under a
+// temporary @id first, then the old one is deleted and the new one takes
+// its @id. If a later step fails the old route is put back.
+func (c *Client) moveRoute(app HTTPApp, p routePlan, svc ServiceConfig) error {
+	id := ServiceRoutePrefix + svc.Name
+	tmp := movingRoutePrefix + svc.Name
+	old, err := c.getRoute(id)
+	if errors.Is(err, ErrRouteNotFound) {
+		return c.insertRoute(app, p, svc) // removed since we read the config
+	}
+	if err != nil {
+		return err
+	}
+	route, err := withID(BuildCaddyRoute(svc), tmp)
+	if err != nil {
+		return err
+	}
+
+	// p.index is counted without the old route; it is still there.
+	pos := p.index
+	same := p.current == p.server
+	if same && pos > p.currentIndex {
+		pos++
+	}
+	if err := c.insertAt(app, p.server, pos, route); err != nil {
+		return err
+	}
+	if err := c.RemoveRoute(svc.Name); err != nil {
+		c.removeID(tmp)
+		return err
+	}
+	_, err = c.do(http.MethodPatch, c.baseURL+"/id/"+tmp, BuildCaddyRoute(svc))
+	if err == nil {
+		return nil
+	}
+
+	// Put the old route back where it was, ahead of the temporary one if
+	// that was inserted before it, then drop the temporary route.
+	back := p.currentIndex
+	if same && pos <= p.currentIndex {
+		back++
+	}
+	if app, rerr := c.httpApp(); rerr != nil || c.insertAt(app, p.current, back, old) != nil {
+		return fmt.Errorf("%w; old route not restored, %s serves the service", err, tmp)
+	}
+	c.removeID(tmp)
+	return err
+}
+
+// getRoute returns the route with the given @id as Caddy stores it.
+func (c *Client) getRoute(id string) (json.RawMessage, error) {
+	resp, err := c.httpClient.Get(c.baseURL + "/id/" + id)
+	if err != nil {
+		return nil, fmt.Errorf("caddy admin api: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrRouteNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("caddy returned %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// removeID deletes the object with the given @id, ignoring errors. It
+// cleans up after a failed move.
+func (c *Client) removeID(id string) {
+	c.do(http.MethodDelete, c.baseURL+"/id/"+id, nil)
+}
+
+// withID returns route with its @id set to id.
+func withID(route json.RawMessage, id string) (json.RawMessage, error) {
+	var m map[string]any
+	if err := json.Unmarshal(route, &m); err != nil {
+		return nil, err
+	}
+	m["@id"] = id
+	return json.Marshal(m)
 }
 
 func (c *Client) do(method, url string, body json.RawMessage) (*http.Response, error) {
@@ -0,0 +1,138 @@
+package caddy
+
+import (
+	"caddy-admin/caddy/caddytest"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// moveFixture is a fake Caddy holding routes for services a and b, with
+// the registry the client orders them by.
+type moveFixture struct {
+	caddy    *caddytest.Server
+	client   *Client
+	services map[string]ServiceConfig
+}
+
+func newMoveFixture(t *testing.T) *moveFixture {
+	f := &moveFixture{caddy: caddytest.NewServer(t, ""), services: map[string]ServiceConfig{}}
+	f.client = NewClient(f.caddy.Addr())
+	f.client.UseRegistry(func() ([]ServiceConfig, error) {
+		var out []ServiceConfig
+		for _, svc := range f.services {
+			out = append(out, svc)
+		}
+		return out, nil
+	})
+	for _, name := range []string{"a", "b"} {
+		svc := ServiceConfig{Name: name, Domain: name + ".test", Upstream: name + ":80"}
+		f.services[name] = svc
+		if err := f.client.AddRoute(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// move stores svc and upserts its route.
+func (f *moveFixture) move(svc ServiceConfig) error {
+	f.services[svc.Name] = svc
+	return f.client.UpsertRoute(svc)
+}
+
+// served reports whether some route in cfg matches host.
+func served(t *testing.T, cfg, host string) bool {
+	t.Helper()
+	var c CaddyConfig
+	if err := json.Unmarshal([]byte(cfg), &c); err != nil {
+		t.Fatal(err)
+	}
+	app, err := c.HTTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, srv := range app.Servers {
+		for _, r := range srv.Routes {
+			for _, m := range r.Match {
+				for _, h := range m.Host {
+					if h == host {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestUpsertRouteMovesWithoutGap(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  ServiceConfig
+		want []string
+	}{
+		{"up", ServiceConfig{Name: "b", Domain: "b.test", Upstream: "b:81", Priority: 5}, []string{"", "svc-b", "svc-a"}},
+		{"down", ServiceConfig{Name: "a", Domain: "a.test", Upstream: "a:81", Priority: -5}, []string{"", "svc-b", "svc-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMoveFixture(t)
+			start := len(f.caddy.Trail())
+			if err := f.move(tt.svc); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.caddy.RouteIDs("srv0"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routes = %v, want %v", got, tt.want)
+			}
+			trail := f.caddy.Trail()[start:]
+			if len(trail) == 0 {
+				t.Fatal("no changes reached caddy")
+			}
+			for i, cfg := range trail {
+				if !served(t, cfg, tt.svc.Domain) {
+					t.Errorf("after change %d nothing routes %s: %s", i+1, tt.svc.Domain, cfg)
+				}
+			}
+			if f.caddy.Count(http.MethodDelete) != 1 {
+				t.Errorf("%d deletes, want 1", f.caddy.Count(http.MethodDelete))
+			}
+		})
+	}
+}
+
+func TestUpsertRouteMoveFailureKeepsOldRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		prefix string
+	}{
+		{"insert", http.MethodPut, "/config/"},
+		{"delete old", http.MethodDelete, "/id/svc-"},
+		{"re-id new", http.MethodPatch, "/id/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMoveFixture(t)
+			before := f.caddy.Config()
+			start := len(f.caddy.Trail())
+
+			f.caddy.FailOn(tt.method, tt.prefix)
+			if err := f.move(ServiceConfig{Name: "b", Domain: "b.test", Upstream: "b:81", Priority: 5}); err == nil {
+				t.Fatal("move succeeded despite failing caddy")
+			}
+			if f.caddy.Count(tt.method) == 0 {
+				t.Fatalf("no %s reached caddy", tt.method)
+			}
+			if after := f.caddy.Config(); after != before {
+				t.Errorf("config changed:\nbefore %s\nafter  %s", before, after)
+			}
+			for i, cfg := range f.caddy.Trail()[start:] {
+				if !served(t, cfg, "b.test") {
+					t.Errorf("after change %d nothing routes b.test: %s", i+1, cfg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigChange is one difference between two Caddy config documents.
+// Path uses the admin API's /config/ path syntax, e.g.
+// "/apps/http/servers/srv0/routes/2/handle/0/upstreams". Array indexes
+// refer to the new document, except for removals, which use the old one.
+type ConfigChange struct {
+	Path   string `json:"path"`
+	Op     string `json:"op"` // "add", "remove" or "replace"
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// DiffConfig returns the structural differences from a to b. Array
+// elements that carry an "@id" (such as svc-* routes) are matched by id,
+// so inserting one route does not report every later route as changed.
+func DiffConfig(a, b json.RawMessage) ([]ConfigChange, error) {
+	var x, y any
+	if len(a) > 0 {
+		if err := json.Unmarshal(a, &x); err != nil {
+			return nil, fmt.Errorf("parse old config: %w", err)
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &y); err != nil {
+			return nil, fmt.Errorf("parse new config: %w", err)
+		}
+	}
+	changes := []ConfigChange{}
+	diffValue("", x, y, &changes)
+	return changes, nil
+}
+
+func diffValue(path string, x, y any, out *[]ConfigChange) {
+	switch {
+	case x == nil && y == nil:
+		return
+	case x == nil:
+		*out = append(*out, ConfigChange{Path: rootPath(path), Op: "add", After: y})
+		return
+	case y == nil:
+		*out = append(*out, ConfigChange{Path: rootPath(path), Op: "remove", Before: x})
+		return
+	}
+
+	switch xv := x.(type) {
+	case map[string]any:
+		if yv, ok := y.(map[string]any); ok {
+			diffObject(path, xv, yv, out)
+			return
+		}
+	case []any:
+		if yv, ok := y.([]any); ok {
+			diffArray(path, xv, yv, out)
+			return
+		}
+	}
+	if !reflect.DeepEqual(x, y) {
+		*out = append(*out, ConfigChange{Path: rootPath(path), Op: "replace", Before: x, After: y})
+	}
+}
+
+func diffObject(path string, x, y map[string]any, out *[]ConfigChange) {
+	keys := make(map[string]bool, len(x)+len(y))
+	for k := range x {
+		keys[k] = true
+	}
+	for k := range y {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		diffValue(path+"/"+k, x[k], y[k], out)
+	}
+}
+
+// diffArray aligns x and y on their longest common subsequence, so
+// inserting one route does not report every later route as changed.
+// Elements with an "@id" are matched by id, others by value; unmatched
+// elements between two matches are compared pairwise.
+func diffArray(path string, x, y []any, out *[]ConfigChange) {
+	xk, yk := elementKeys(x), elementKeys(y)
+
+	// lcs[i][j] is the LCS length of xk[i:] and yk[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if xk[i] == yk[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var removed, added []int
+	flush := func() {
+		for n := 0; n < len(removed) || n < len(added); n++ {
+			switch {
+			case n < len(removed) && n < len(added) && !isIDKey(xk[removed[n]]) && !isIDKey(yk[added[n]]):
+				diffValue(elementPath(path, added[n]), x[removed[n]], y[added[n]], out)
+			default:
+				if n < len(removed) {
+					diffValue(elementPath(path, removed[n]), x[removed[n]], nil, out)
+				}
+				if n < len(added) {
+					diffValue(elementPath(path, added[n]), nil, y[added[n]], out)
+				}
+			}
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && xk[i] == yk[j]:
+			flush()
+			diffValue(elementPath(path, j), x[i], y[j], out)
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			added = append(added, j)
+			j++
+		default:
+			removed = append(removed, i)
+			i++
+		}
+	}
+	flush()
+}
+
+// elementKeys returns the identity used to align array elements.
+func elementKeys(arr []any) []string {
+	keys := make([]string, len(arr))
+	for i, el := range arr {
+		if obj, ok := el.(map[string]any); ok {
+			if id, ok := obj["@id"].(string); ok && id != "" {
+				keys[i] = "@id:" + id
+				continue
+			}
+		}
+		data, _ := json.Marshal(el)
+		keys[i] = string(data)
+	}
+	return keys
+}
+
+func isIDKey(key string) bool {
+	return strings.HasPrefix(key, "@id:")
+}
+
+func elementPath(path string, i int) string {
+	return path + "/" + strconv.Itoa(i)
+}
+
+func rootPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,111 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict owners.
+const (
+	OwnerService   = "service"   // another registered service
+	OwnerCaddyfile = "caddyfile" // a route not managed by caddy-admin
+)
+
+// Conflict is an existing route that a service would shadow or compete
+// with.
+type Conflict struct {
+	Domain string `json:"domain"`
+	// Path is the overlapping path prefix of the existing route ("" = all).
+	Path  string `json:"path,omitempty"`
+	Owner string `json:"owner"`
+	// Service names the owning service when Owner is OwnerService.
+	Service string `json:"service,omitempty"`
+}
+
+func (c Conflict) String() string {
+	where := c.Domain + c.Path
+	if c.Owner == OwnerService {
+		return fmt.Sprintf("%s is already served by service %q", where, c.Service)
+	}
+	return fmt.Sprintf("%s is already served by a Caddyfile site", where)
+}
+
+// FindConflicts reports the routes svc would collide with: other stored
+// services and live Caddy sites with a domain that matches one of svc's,
+// in either direction and wildcards included, and whose paths overlap. A
+// wildcard site that proxies or serves files conflicts with every host it
+// covers; one that only answers a fixed response (the usual TLS catch-all
+// that services are meant to be placed in front of) does not.
+func FindConflicts(svc ServiceConfig, sites []SiteInfo, services []ServiceConfig) []Conflict {
+	mine := svc.DomainList()
+
+	var conflicts []Conflict
+	stored := make(map[string]bool, len(services))
+	for _, other := range services {
+		stored[other.Name] = true
+		if other.Name == svc.Name || !pathsOverlap(svc.Path, other.Path) {
+			continue
+		}
+		for _, d := range other.DomainList() {
+			if domainsOverlap(mine, d) {
+				conflicts = append(conflicts, Conflict{
+					Domain:  d,
+					Path:    other.Path,
+					Owner:   OwnerService,
+					Service: other.Name,
+				})
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, site := range sites {
+		if site.Service == svc.Name || stored[site.Service] {
+			continue
+		}
+		for _, host := range site.Hosts() {
+			if !domainsOverlap(mine, host) || strings.Contains(host, "*") && site.Type == "unknown" {
+				continue
+			}
+			paths := []string{""}
+			if len(site.Paths) > 0 {
+				paths = site.Paths
+			}
+			for _, p := range paths {
+				p = normalizePath(p)
+				if !pathsOverlap(svc.Path, p) {
+					continue
+				}
+				c := Conflict{Domain: host, Path: p, Owner: OwnerCaddyfile}
+				if site.Service != "" {
+					// A svc-* route left in Caddy without a stored service
+					c.Owner = OwnerService
+					c.Service = site.Service
+				}
+				if key := c.String(); !seen[key] {
+					seen[key] = true
+					conflicts = append(conflicts, c)
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// domainsOverlap reports whether host and any of domains can match the
+// same request: either one, as a host matcher pattern, matches the other.
+func domainsOverlap(domains []string, host string) bool {
+	for _, d := range domains {
+		if hostMatches(d, host) || hostMatches(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsOverlap reports whether two normalized path prefixes can match the
+// same request. "" matches every path.
+func pathsOverlap(a, b string) bool {
+	return a == "" || b == "" || a == b ||
+		strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
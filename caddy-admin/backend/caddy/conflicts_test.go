@@ -0,0 +1,50 @@
+package caddy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindConflicts(t *testing.T) {
+	sites := []SiteInfo{
+		{Domain: "static.example.com"},
+		{Domain: "*.apps.example.com", Type: "proxy"},
+		{Domain: "*.example.com", Type: "unknown"}, // respond-only catch-all
+		{Domain: "docs.example.com", Paths: []string{"/v1/*"}},
+	}
+	services := []ServiceConfig{
+		{Name: "api", Domain: "api.example.com"},
+		{Name: "preview", Domain: "*.preview.example.com"},
+	}
+	tests := []struct {
+		name string
+		svc  ServiceConfig
+		want []Conflict
+	}{
+		{"no overlap", ServiceConfig{Name: "new", Domain: "new.example.com"}, nil},
+		{"exact service", ServiceConfig{Name: "new", Domain: "API.example.com"},
+			[]Conflict{{Domain: "api.example.com", Owner: OwnerService, Service: "api"}}},
+		{"wildcard over service", ServiceConfig{Name: "new", Domain: "*.example.com"},
+			[]Conflict{
+				{Domain: "api.example.com", Owner: OwnerService, Service: "api"},
+				{Domain: "static.example.com", Owner: OwnerCaddyfile},
+				{Domain: "docs.example.com", Path: "/v1", Owner: OwnerCaddyfile},
+			}},
+		{"host under service wildcard", ServiceConfig{Name: "new", Domain: "pr-1.preview.example.com"},
+			[]Conflict{{Domain: "*.preview.example.com", Owner: OwnerService, Service: "preview"}}},
+		{"host under wildcard site", ServiceConfig{Name: "new", Domain: "x.apps.example.com"},
+			[]Conflict{{Domain: "*.apps.example.com", Owner: OwnerCaddyfile}}},
+		{"host under respond-only catch-all", ServiceConfig{Name: "new", Domain: "new.example.com", Path: "/x"}, nil},
+		{"wildcard one label deep only", ServiceConfig{Name: "new", Domain: "a.b.apps.example.com"}, nil},
+		{"disjoint paths", ServiceConfig{Name: "new", Domain: "docs.example.com", Path: "/v2"}, nil},
+		{"own service", ServiceConfig{Name: "api", Domain: "api.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindConflicts(tt.svc, sites, services)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package caddy
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Host coverage states.
+const (
+	CoverageOK        = "ok"
+	CoverageExpiring  = "expiring"
+	CoverageExpired   = "expired"
+	CoverageUncovered = "uncovered"
+	// CoveragePlainHTTP hosts are only served without TLS and need no cert.
+	CoveragePlainHTTP = "plain_http"
+)
+
+// Coverage matches every served hostname against the known certificates.
+type Coverage struct {
+	// ExpiringDays is the window used for CoverageExpiring.
+	ExpiringDays int             `json:"expiringDays"`
+	Hosts        []HostCoverage  `json:"hosts"`
+	Uncovered    []string        `json:"uncovered"`
+	Expiring     []string        `json:"expiring"` // expiring or expired
+	UnusedCerts  []CertReference `json:"unusedCerts"`
+}
+
+// HostCoverage is one hostname (or wildcard pattern) and the cert that
+// would serve it.
+type HostCoverage struct {
+	Host string `json:"host"`
+	// Service names the registered service claiming the host, if any.
+	Service string `json:"service,omitempty"`
+	// InCaddy is false for a registered service with no live route.
+	InCaddy bool           `json:"inCaddy"`
+	Status  string         `json:"status"`
+	Cert    *CertReference `json:"cert,omitempty"`
+	// Alternatives lists other certs whose SANs also match.
+	Alternatives []CertReference `json:"alternatives,omitempty"`
+}
+
+// CertReference identifies a certificate in a coverage report.
+type CertReference struct {
+	Fingerprint string    `json:"fingerprint"`
+	Domain      string    `json:"domain"`
+	Source      string    `json:"source"`
+	NotAfter    time.Time `json:"notAfter"`
+	DaysLeft    int       `json:"daysLeft"`
+	// MatchedSAN is the SAN that covers the host.
+	MatchedSAN string `json:"matchedSan,omitempty"`
+}
+
+// BuildCoverage matches the hosts of sites and services against certs.
+// A host is covered by a SAN equal to it or by a wildcard SAN matching
+// one label; a cert with an exact SAN is preferred over a wildcard, then
+// the one expiring last. Hosts only served by non-TLS servers are
+// reported but not flagged.
+func BuildCoverage(sites []SiteInfo, services []ServiceConfig, certs []CertInfo, expiringDays int) Coverage {
+	type host struct {
+		service string
+		inCaddy bool
+		tls     bool
+	}
+	hosts := make(map[string]*host)
+	get := func(name string) *host {
+		name = strings.ToLower(name)
+		if hosts[name] == nil {
+			hosts[name] = &host{}
+		}
+		return hosts[name]
+	}
+	for _, s := range sites {
+		for _, name := range s.Hosts() {
+			h := get(name)
+			h.inCaddy = true
+			h.tls = h.tls || s.TLS
+			if s.Service != "" {
+				h.service = s.Service
+			}
+		}
+	}
+	for _, svc := range services {
+		for _, name := range svc.DomainList() {
+			h := get(name)
+			h.service = svc.Name
+			if !h.inCaddy {
+				// No live route yet: assume it will be served over HTTPS
+				// unless the service asks for plain HTTP.
+				h.tls = svc.Scheme != "http"
+			}
+		}
+	}
+
+	cov := Coverage{
+		ExpiringDays: expiringDays,
+		Hosts:        []HostCoverage{},
+		Uncovered:    []string{},
+		Expiring:     []string{},
+		UnusedCerts:  []CertReference{},
+	}
+	used := make(map[string]bool)
+	for name, h := range hosts {
+		hc := HostCoverage{Host: name, Service: h.service, InCaddy: h.inCaddy}
+		var matches []CertReference
+		exact := make(map[string]bool)
+		for _, c := range certs {
+			if san, ok := certCovers(c, name); ok {
+				ref := certReference(c)
+				ref.MatchedSAN = san
+				matches = append(matches, ref)
+				exact[c.Fingerprint] = strings.EqualFold(san, name)
+				used[c.Fingerprint] = true
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i], matches[j]
+			if exact[a.Fingerprint] != exact[b.Fingerprint] {
+				return exact[a.Fingerprint]
+			}
+			return a.NotAfter.After(b.NotAfter)
+		})
+
+		switch {
+		case !h.tls:
+			hc.Status = CoveragePlainHTTP
+		case len(matches) == 0:
+			hc.Status = CoverageUncovered
+			cov.Uncovered = append(cov.Uncovered, name)
+		case matches[0].DaysLeft < 0:
+			hc.Status = CoverageExpired
+			cov.Expiring = append(cov.Expiring, name)
+		case matches[0].DaysLeft <= expiringDays:
+			hc.Status = CoverageExpiring
+			cov.Expiring = append(cov.Expiring, name)
+		default:
+			hc.Status = CoverageOK
+		}
+		if len(matches) > 0 {
+			hc.Cert = &matches[0]
+			hc.Alternatives = matches[1:]
+		}
+		cov.Hosts = append(cov.Hosts, hc)
+	}
+
+	for _, c := range certs {
+		if !used[c.Fingerprint] {
+			cov.UnusedCerts = append(cov.UnusedCerts, certReference(c))
+		}
+	}
+	sort.Slice(cov.Hosts, func(i, j int) bool { return cov.Hosts[i].Host < cov.Hosts[j].Host })
+	sort.Strings(cov.Uncovered)
+	sort.Strings(cov.Expiring)
+	return cov
+}
+
+// Covers reports whether one of c's SANs covers host.
+func (c CertInfo) Covers(host string) bool {
+	_, ok := certCovers(c, host)
+	return ok
+}
+
+// certCovers returns the first SAN of c that covers host. A wildcard
+// host pattern is only covered by the same wildcard SAN.
+func certCovers(c CertInfo, host string) (string, bool) {
+	sans := c.SANs
+	if len(sans) == 0 {
+		sans = []string{c.Domain}
+	}
+	for _, san := range sans {
+		if strings.EqualFold(san, host) {
+			return san, true
+		}
+	}
+	if strings.Contains(host, "*") {
+		return "", false
+	}
+	for _, san := range sans {
+		// X.509 wildcards are only valid as the whole leftmost label.
+		if strings.HasPrefix(san, "*.") && !strings.Contains(san[2:], "*") && hostMatches(san, host) {
+			return san, true
+		}
+	}
+	return "", false
+}
+
+func certReference(c CertInfo) CertReference {
+	return CertReference{
+		Fingerprint: c.Fingerprint,
+		Domain:      c.Domain,
+		Source:      c.Source,
+		NotAfter:    c.NotAfter,
+		DaysLeft:    c.DaysLeft,
+	}
+}
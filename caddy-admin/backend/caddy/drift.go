@@ -0,0 +1,176 @@
+package caddy
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ServiceRoutePrefix is the @id prefix of routes owned by caddy-admin.
+const ServiceRoutePrefix = "svc-"
+
+// DriftReport compares the service registry with the live Caddy config.
+type DriftReport struct {
+	InSync   []string     `json:"inSync"`
+	Missing  []string     `json:"missing"`  // in the store, no route in Caddy
+	Orphaned []RouteState `json:"orphaned"` // svc-* route in Caddy, not in the store
+	Changed  []RouteDrift `json:"changed"`  // both exist but differ
+}
+
+// HasDrift reports whether anything is out of sync.
+func (d DriftReport) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Orphaned) > 0 || len(d.Changed) > 0
+}
+
+// RouteState is the domain/path/upstream view of a svc-* route.
+type RouteState struct {
+	Name      string   `json:"name"`
+	Server    string   `json:"server"`
+	Domains   []string `json:"domains"`
+	Paths     []string `json:"paths,omitempty"`
+	Upstreams []string `json:"upstreams"`
+}
+
+// RouteDrift describes one service whose live route differs from the store.
+// Fields lists what differs: "domain", "path", "upstream", or "route" for
+// any other change (headers, load balancing, health checks, ...).
+type RouteDrift struct {
+	Name     string     `json:"name"`
+	Fields   []string   `json:"fields"`
+	Expected RouteState `json:"expected"`
+	Actual   RouteState `json:"actual"`
+}
+
+// liveRoute is a svc-* route found in the Caddy config.
+type liveRoute struct {
+	state RouteState
+	raw   json.RawMessage
+}
+
+// DetectDrift compares every stored service with the svc-* routes in cfg.
+func DetectDrift(cfg *CaddyConfig, services []ServiceConfig) DriftReport {
+	live := serviceRoutes(cfg)
+	report := DriftReport{
+		InSync:   []string{},
+		Missing:  []string{},
+		Orphaned: []RouteState{},
+		Changed:  []RouteDrift{},
+	}
+
+	stored := make(map[string]bool, len(services))
+	for _, svc := range services {
+		stored[svc.Name] = true
+		lr, ok := live[svc.Name]
+		if !ok {
+			report.Missing = append(report.Missing, svc.Name)
+			continue
+		}
+
+		want := BuildCaddyRoute(svc)
+		expected := routeState(svc.Name, lr.state.Server, want)
+		fields := diffStates(expected, lr.state)
+		if len(fields) == 0 && !jsonEqual(want, lr.raw) {
+			fields = append(fields, "route")
+		}
+		if len(fields) == 0 {
+			report.InSync = append(report.InSync, svc.Name)
+			continue
+		}
+		report.Changed = append(report.Changed, RouteDrift{
+			Name:     svc.Name,
+			Fields:   fields,
+			Expected: expected,
+			Actual:   lr.state,
+		})
+	}
+
+	for name, lr := range live {
+		if !stored[name] {
+			report.Orphaned = append(report.Orphaned, lr.state)
+		}
+	}
+	sort.Slice(report.Orphaned, func(i, j int) bool {
+		return report.Orphaned[i].Name < report.Orphaned[j].Name
+	})
+	return report
+}
+
+// serviceRoutes returns the top-level svc-* routes of every server by name.
+func serviceRoutes(cfg *CaddyConfig) map[string]liveRoute {
+	result := make(map[string]liveRoute)
+	httpRaw, ok := cfg.Apps["http"]
+	if !ok {
+		return result
+	}
+	var httpApp struct {
+		Servers map[string]struct {
+			Routes []json.RawMessage `json:"routes"`
+		} `json:"servers"`
+	}
+	if err := json.Unmarshal(httpRaw, &httpApp); err != nil {
+		return result
+	}
+	for serverName, server := range httpApp.Servers {
+		for _, raw := range server.Routes {
+			var id struct {
+				ID string `json:"@id"`
+			}
+			if err := json.Unmarshal(raw, &id); err != nil || !strings.HasPrefix(id.ID, ServiceRoutePrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(id.ID, ServiceRoutePrefix)
+			result[name] = liveRoute{state: routeState(name, serverName, raw), raw: raw}
+		}
+	}
+	return result
+}
+
+func routeState(name, server string, raw json.RawMessage) RouteState {
+	state := RouteState{Name: name, Server: server}
+	var route HTTPRoute
+	if err := json.Unmarshal(raw, &route); err != nil {
+		return state
+	}
+	for _, m := range route.Match {
+		state.Domains = append(state.Domains, m.Host...)
+		state.Paths = append(state.Paths, m.Path...)
+	}
+	var site SiteInfo
+	extractHandlerInfo(&site, route.Handle)
+	state.Upstreams = site.Upstreams
+	return state
+}
+
+func diffStates(want, got RouteState) []string {
+	var fields []string
+	if !sameSet(want.Domains, got.Domains) {
+		fields = append(fields, "domain")
+	}
+	if !sameSet(want.Paths, got.Paths) {
+		fields = append(fields, "path")
+	}
+	if !sameSet(want.Upstreams, got.Upstreams) {
+		fields = append(fields, "upstream")
+	}
+	return fields
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	return reflect.DeepEqual(x, y)
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
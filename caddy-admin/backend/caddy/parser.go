@@ -2,8 +2,10 @@ package caddy
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,12 +15,24 @@ import (
 
 // SiteInfo is the extracted info for one virtual host
 type SiteInfo struct {
-	Domain   string            `json:"domain"`
-	Type     string            `json:"type"`     // "static" | "proxy" | "unknown"
-	Root     string            `json:"root,omitempty"`
-	Upstream string            `json:"upstream,omitempty"`
-	Headers  map[string]string `json:"headers,omitempty"`
-	HasTLS   bool              `json:"hasTLS"`
+	Domain string `json:"domain"`
+	// Aliases are the other hostnames or patterns of the same host
+	// matcher, e.g. the extra domains of a multi-domain service.
+	Aliases   []string          `json:"aliases,omitempty"`
+	Paths     []string          `json:"paths,omitempty"`
+	Type      string            `json:"type"` // "static" | "proxy" | "unknown"
+	Root      string            `json:"root,omitempty"`
+	Upstream  string            `json:"upstream,omitempty"`
+	Upstreams []string          `json:"upstreams,omitempty"`
+	LBPolicy  string            `json:"lbPolicy,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	HasTLS    bool              `json:"hasTLS"`
+	// Service names the registered service when the route is a svc-* route.
+	Service string `json:"service,omitempty"`
+	// Server is the Caddy server the route belongs to; TLS tells whether
+	// that server terminates TLS.
+	Server string `json:"server"`
+	TLS    bool   `json:"tls"`
 }
 
 // CertInfo is the extracted info for one TLS certificate
@@ -30,6 +44,18 @@ type CertInfo struct {
 	DaysLeft  int       `json:"daysLeft"`
 	IsExpired bool      `json:"isExpired"`
 	Source    string    `json:"source"` // "letsencrypt" | "local" | "zerossl" | "unknown"
+	// SANs lists every DNS name and IP address the certificate covers.
+	SANs               []string `json:"sans"`
+	Serial             string   `json:"serial"`  // hex
+	KeyType            string   `json:"keyType"` // "RSA" | "ECDSA" | "Ed25519"
+	KeySize            int      `json:"keySize,omitempty"`
+	SignatureAlgorithm string   `json:"signatureAlgorithm"`
+	// Fingerprint is the lowercase hex SHA-256 of the DER certificate.
+	Fingerprint string `json:"fingerprint"`
+	// Chain holds the intermediates bundled after the leaf, in file order.
+	Chain []ChainCert `json:"chain"`
+	// File is the file name of an external certificate.
+	File string `json:"file,omitempty"`
 }
 
 // ParseSites extracts all virtual hosts from the Caddy config
@@ -47,24 +73,70 @@ func ParseSites(cfg *CaddyConfig) []SiteInfo {
 	// Collect domains managed by TLS automation
 	tlsDomains := parseTLSDomains(cfg)
 
+	names := make([]string, 0, len(httpApp.Servers))
+	for name := range httpApp.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// One site per host matcher, in the order Caddy evaluates routes.
 	var sites []SiteInfo
-	for _, server := range httpApp.Servers {
+	for _, name := range names {
+		server := httpApp.Servers[name]
 		for _, route := range server.Routes {
 			for _, match := range route.Match {
+				if len(match.Host) == 0 {
+					continue
+				}
+				site := SiteInfo{
+					Domain: match.Host[0],
+					Paths:  match.Path,
+					Server: name,
+					TLS:    server.servesTLS(),
+				}
+				if len(match.Host) > 1 {
+					site.Aliases = match.Host[1:]
+				}
 				for _, host := range match.Host {
-					site := SiteInfo{
-						Domain: host,
-						HasTLS: tlsDomains[host],
-					}
-					extractHandlerInfo(&site, route.Handle)
-					sites = append(sites, site)
+					site.HasTLS = site.HasTLS || tlsDomains[host]
+				}
+				if strings.HasPrefix(route.ID, ServiceRoutePrefix) {
+					site.Service = strings.TrimPrefix(route.ID, ServiceRoutePrefix)
 				}
+				extractHandlerInfo(&site, route.Handle)
+				sites = append(sites, site)
 			}
 		}
 	}
 	return sites
 }
 
+// Hosts returns Domain followed by Aliases.
+func (s SiteInfo) Hosts() []string {
+	return append([]string{s.Domain}, s.Aliases...)
+}
+
+// ResolveSite returns the site that serves host: a site listing host
+// exactly, otherwise the first site (in route order) with a wildcard
+// pattern matching it.
+func ResolveSite(sites []SiteInfo, host string) (SiteInfo, bool) {
+	for _, s := range sites {
+		for _, h := range s.Hosts() {
+			if strings.EqualFold(h, host) {
+				return s, true
+			}
+		}
+	}
+	for _, s := range sites {
+		for _, h := range s.Hosts() {
+			if strings.Contains(h, "*") && hostMatches(h, host) {
+				return s, true
+			}
+		}
+	}
+	return SiteInfo{}, false
+}
+
 // parseTLSDomains returns a set of domains with TLS automation
 func parseTLSDomains(cfg *CaddyConfig) map[string]bool {
 	result := make(map[string]bool)
@@ -107,8 +179,14 @@ func extractHandlerInfo(site *SiteInfo, handles []json.RawMessage) {
 			}
 		case "reverse_proxy":
 			site.Type = "proxy"
-			if len(h.Upstreams) > 0 {
-				site.Upstream = h.Upstreams[0].Dial
+			for _, u := range h.Upstreams {
+				site.Upstreams = append(site.Upstreams, u.Dial)
+			}
+			if len(site.Upstreams) > 0 {
+				site.Upstream = site.Upstreams[0]
+			}
+			if h.LoadBalancing != nil && h.LoadBalancing.SelectionPolicy != nil {
+				site.LBPolicy = h.LoadBalancing.SelectionPolicy.Policy
 			}
 		case "headers":
 			if h.Response != nil && len(h.Response.Set) > 0 {
@@ -155,29 +233,18 @@ func ReadCerts(certStorePath string) []CertInfo {
 			}
 			domain := domainEntry.Name()
 			certFile := filepath.Join(issuerDir, domain, domain+".crt")
-			cert, err := parseCertFile(certFile)
+			chain, err := parseCertFile(certFile)
 			if err != nil {
 				continue
 			}
-
-			source := classifyIssuerDir(issuerEntry.Name())
-			daysLeft := int(time.Until(cert.NotAfter).Hours() / 24)
-
-			certs = append(certs, CertInfo{
-				Domain:    domain,
-				Issuer:    cert.Issuer.CommonName,
-				NotBefore: cert.NotBefore,
-				NotAfter:  cert.NotAfter,
-				DaysLeft:  daysLeft,
-				IsExpired: daysLeft < 0,
-				Source:    source,
-			})
+			certs = append(certs, newCertInfo(domain, classifyIssuerDir(issuerEntry.Name()), chain))
 		}
 	}
 	return certs
 }
 
 // ReadExternalCerts reads PEM certificate files from a flat directory (e.g. acme.sh install-cert output)
+// Files holding only CA certificates are skipped, as certwatch does.
 func ReadExternalCerts(dir string) []CertInfo {
 	var certs []CertInfo
 
@@ -200,26 +267,18 @@ func ReadExternalCerts(dir string) []CertInfo {
 		}
 
 		certPath := filepath.Join(dir, name)
-		cert, err := parseCertFile(certPath)
+		chain, err := parseCertFile(certPath)
 		if err != nil {
-			continue
+			continue // unreadable, or ErrChainOnly
 		}
-
-		daysLeft := int(time.Until(cert.NotAfter).Hours() / 24)
-		domain := cert.Subject.CommonName
-		if len(cert.DNSNames) > 0 {
-			domain = cert.DNSNames[0]
+		leaf := chain[0]
+		domain := leaf.Subject.CommonName
+		if len(leaf.DNSNames) > 0 {
+			domain = leaf.DNSNames[0]
 		}
-
-		certs = append(certs, CertInfo{
-			Domain:    domain,
-			Issuer:    cert.Issuer.CommonName,
-			NotBefore: cert.NotBefore,
-			NotAfter:  cert.NotAfter,
-			DaysLeft:  daysLeft,
-			IsExpired: daysLeft < 0,
-			Source:    classifyIssuer(cert.Issuer.CommonName),
-		})
+		info := newCertInfo(domain, classifyIssuer(leaf.Issuer.CommonName), chain)
+		info.File = name
+		certs = append(certs, info)
 	}
 	return certs
 }
@@ -237,16 +296,54 @@ func classifyIssuer(issuerCN string) string {
 	}
 }
 
-func parseCertFile(path string) (*x509.Certificate, error) {
+// ErrChainOnly marks a PEM bundle holding only CA certificates, such as
+// a ca.pem or chain.pem next to the leaf. It is not a certificate any
+// site is served with, so it is neither listed nor hot-reloaded.
+var ErrChainOnly = errors.New("CA certificates only")
+
+// ParseBundle decodes every CERTIFICATE block of a PEM bundle and returns
+// them leaf first. The leaf is the first certificate that is not a CA; a
+// bundle without one yields ErrChainOnly.
+func ParseBundle(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	leaf := -1
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if leaf < 0 && !cert.IsCA {
+			leaf = len(chain)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates in PEM data")
+	}
+	if leaf < 0 {
+		return nil, ErrChainOnly
+	}
+	if leaf > 0 {
+		chain = append(append([]*x509.Certificate{chain[leaf]}, chain[:leaf]...), chain[leaf+1:]...)
+	}
+	return chain, nil
+}
+
+// parseCertFile reads a PEM bundle with ParseBundle.
+func parseCertFile(path string) ([]*x509.Certificate, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	block, _ := pem.Decode(data)
-	if block == nil {
-		return nil, os.ErrInvalid
-	}
-	return x509.ParseCertificate(block.Bytes)
+	return ParseBundle(data)
 }
 
 func classifyIssuerDir(name string) string {
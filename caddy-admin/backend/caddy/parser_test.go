@@ -0,0 +1,80 @@
+package caddy
+
+import (
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func pemCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParseBundle(t *testing.T) {
+	ca := newTestCA(t)
+	leaf := pemCert(ca.issue(t, "a.test", time.Hour).Certificate[0])
+	root := pemCert(ca.cert.Raw)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string // leaf CN
+		chain   int
+		wantErr error
+	}{
+		{"leaf", leaf, "a.test", 1, nil},
+		{"fullchain", append(append([]byte{}, leaf...), root...), "a.test", 2, nil},
+		{"ca first", append(append([]byte{}, root...), leaf...), "a.test", 2, nil},
+		{"ca only", root, "", 0, ErrChainOnly},
+	}
+	for _, tt := range tests {
+		chain, err := ParseBundle(tt.data)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if chain[0].Subject.CommonName != tt.want || len(chain) != tt.chain {
+			t.Errorf("%s: leaf %q, %d certs; want %q, %d", tt.name, chain[0].Subject.CommonName, len(chain), tt.want, tt.chain)
+		}
+	}
+	if _, err := ParseBundle([]byte("not pem")); err == nil {
+		t.Error("ParseBundle accepted data without certificates")
+	}
+}
+
+func TestReadExternalCertsSkipsCAFiles(t *testing.T) {
+	ca := newTestCA(t)
+	leaf := pemCert(ca.issue(t, "a.test", time.Hour).Certificate[0])
+	root := pemCert(ca.cert.Raw)
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"cert.pem":      leaf,
+		"fullchain.pem": append(append([]byte{}, leaf...), root...),
+		"ca.pem":        root,
+		"chain.pem":     append(append([]byte{}, root...), root...),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	certs := ReadExternalCerts(dir)
+	if len(certs) != 2 {
+		t.Fatalf("got %d certs, want cert.pem and fullchain.pem: %+v", len(certs), certs)
+	}
+	for _, c := range certs {
+		if c.Domain != "a.test" || c.File == "ca.pem" || c.File == "chain.pem" {
+			t.Errorf("listed %s for %s", c.File, c.Domain)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Preview is what a mutation would do to Caddy, computed without
+// sending anything.
+type Preview struct {
+	// Routes holds the route JSON each service would be given, by name.
+	Routes map[string]json.RawMessage `json:"routes"`
+	// Changes is the structural diff from the current /config/ document.
+	Changes []ConfigChange `json:"changes"`
+}
+
+// PreviewUpsert returns what UpsertRoute for each of services, applied in
+// order to the current /config/ document, would change.
+func (c *Client) PreviewUpsert(current json.RawMessage, services ...ServiceConfig) (*Preview, error) {
+	doc, err := decodeConfig(current)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{Routes: make(map[string]json.RawMessage, len(services))}
+	for _, svc := range services {
+		route := BuildCaddyRoute(svc)
+		if err := c.previewRoute(doc, svc, route); err != nil {
+			return nil, err
+		}
+		p.Routes[svc.Name] = route
+	}
+	return p.diff(current, doc)
+}
+
+// PreviewRemove returns what RemoveRoute for name would change.
+func (c *Client) PreviewRemove(current json.RawMessage, name string) (*Preview, error) {
+	doc, err := decodeConfig(current)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{Routes: map[string]json.RawMessage{}}
+	if server, i := findRoute(doc, ServiceRoutePrefix+name); server != nil {
+		routes := server["routes"].([]any)
+		server["routes"] = append(routes[:i:i], routes[i+1:]...)
+	}
+	return p.diff(current, doc)
+}
+
+func (p *Preview) diff(current json.RawMessage, doc map[string]any) (*Preview, error) {
+	next, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	if p.Changes, err = DiffConfig(current, next); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeConfig(raw json.RawMessage) (map[string]any, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	return doc, nil
+}
+
+// previewRoute mirrors UpsertRoute on a decoded config: replace the route
+// in place if it is already where it belongs, otherwise move or insert it
+// where AddRoute would.
+func (c *Client) previewRoute(doc map[string]any, svc ServiceConfig, route json.RawMessage) error {
+	var r any
+	if err := json.Unmarshal(route, &r); err != nil {
+		return err
+	}
+	app, err := typedHTTPApp(doc)
+	if err != nil {
+		return err
+	}
+	p, err := c.planRoute(app, svc)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.inPlace():
+		serverMaps(doc)[p.server]["routes"].([]any)[p.index] = r
+		return nil
+	case p.current != "":
+		server := serverMaps(doc)[p.current]
+		routes := server["routes"].([]any)
+		i := p.currentIndex
+		server["routes"] = append(routes[:i:i], routes[i+1:]...)
+	}
+
+	server := serverMaps(doc)[p.server]
+	routes, _ := server["routes"].([]any)
+	i := min(p.index, len(routes))
+	server["routes"] = append(routes[:i:i], append([]any{r}, routes[i:]...)...)
+	return nil
+}
+
+// typedHTTPApp decodes the http app of a generic config document.
+func typedHTTPApp(doc map[string]any) (HTTPApp, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return HTTPApp{}, err
+	}
+	var cfg CaddyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return HTTPApp{}, err
+	}
+	return cfg.HTTP()
+}
+
+// findRoute locates the top-level route with the given @id.
+func findRoute(doc map[string]any, id string) (map[string]any, int) {
+	for _, server := range serverMaps(doc) {
+		routes, _ := server["routes"].([]any)
+		for i, r := range routes {
+			if obj, ok := r.(map[string]any); ok && obj["@id"] == id {
+				return server, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// serverMaps returns apps.http.servers of a decoded config.
+func serverMaps(doc map[string]any) map[string]map[string]any {
+	out := map[string]map[string]any{}
+	apps, _ := doc["apps"].(map[string]any)
+	httpApp, _ := apps["http"].(map[string]any)
+	servers, _ := httpApp["servers"].(map[string]any)
+	for name, s := range servers {
+		if server, ok := s.(map[string]any); ok {
+			out[name] = server
+		}
+	}
+	return out
+}
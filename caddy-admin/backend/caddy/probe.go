@@ -0,0 +1,200 @@
+package caddy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Probe statuses.
+const (
+	ProbeMatch = "match" // Caddy presents the same cert as on disk
+	// ProbeStale means a newer cert covering the host is on disk than the
+	// one Caddy presents, typically renewed files without a reload.
+	ProbeStale     = "stale"
+	ProbeMismatch  = "mismatch"    // Caddy presents a different cert
+	ProbeNotOnDisk = "not_on_disk" // no cert on disk covers the host
+	ProbeError     = "error"       // the handshake failed
+)
+
+// ProbeResult is what Caddy presented for one hostname.
+type ProbeResult struct {
+	Host   string `json:"host"`
+	Addr   string `json:"addr"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Protocol and ALPN are the negotiated TLS version and protocol.
+	Protocol string `json:"protocol,omitempty"`
+	ALPN     string `json:"alpn,omitempty"`
+	// ChainValid reports whether the presented chain verifies for Host
+	// against the prober's roots; ChainError says why not.
+	ChainValid bool      `json:"chainValid"`
+	ChainError string    `json:"chainError,omitempty"`
+	Presented  *CertInfo `json:"presented,omitempty"`
+	// Disk is the on-disk cert that should serve Host, if any.
+	Disk *CertReference `json:"disk,omitempty"`
+}
+
+// Prober performs TLS handshakes against Caddy's HTTPS listener, one per
+// hostname using SNI.
+type Prober struct {
+	// Addr is the listener to dial, e.g. "caddy:443".
+	Addr    string
+	Timeout time.Duration
+	// RootCAs verifies presented chains; nil uses the system pool.
+	RootCAs *x509.CertPool
+}
+
+// probeConcurrency caps simultaneous handshakes.
+const probeConcurrency = 8
+
+// ProbeAll probes every host and compares each presented cert with the
+// on-disk certs. Results are sorted by host.
+func (p *Prober) ProbeAll(ctx context.Context, hosts []string, disk []CertInfo) []ProbeResult {
+	results := make([]ProbeResult, len(hosts))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = p.Probe(ctx, host, disk)
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	return results
+}
+
+// Probe handshakes with host as SNI and compares the result with disk.
+func (p *Prober) Probe(ctx context.Context, host string, disk []CertInfo) ProbeResult {
+	res := ProbeResult{Host: host, Addr: p.Addr}
+	if ref, ok := diskCertFor(host, disk); ok {
+		res.Disk = &ref
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config: &tls.Config{
+			ServerName: host,
+			NextProtos: []string{"h2", "http/1.1"},
+			// Verified below, so an invalid chain is still reported.
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		res.Status = ProbeError
+		res.Error = err.Error()
+		return res
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	res.Protocol = tls.VersionName(state.Version)
+	res.ALPN = state.NegotiatedProtocol
+	if len(state.PeerCertificates) == 0 {
+		res.Status = ProbeError
+		res.Error = "no certificate presented"
+		return res
+	}
+
+	leaf := state.PeerCertificates[0]
+	domain := leaf.Subject.CommonName
+	if len(leaf.DNSNames) > 0 {
+		domain = leaf.DNSNames[0]
+	}
+	info := newCertInfo(domain, classifyIssuer(leaf.Issuer.CommonName), state.PeerCertificates)
+	res.Presented = &info
+
+	intermediates := x509.NewCertPool()
+	for _, c := range state.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         p.RootCAs,
+		Intermediates: intermediates,
+	})
+	res.ChainValid = err == nil
+	if err != nil {
+		res.ChainError = err.Error()
+	}
+
+	switch {
+	case res.Disk == nil:
+		res.Status = ProbeNotOnDisk
+	case res.Disk.Fingerprint == info.Fingerprint:
+		res.Status = ProbeMatch
+	case res.Disk.NotAfter.After(info.NotAfter):
+		res.Status = ProbeStale
+	default:
+		res.Status = ProbeMismatch
+	}
+	return res
+}
+
+// ProbeHosts returns the concrete hostnames that should be served over
+// TLS: site hosts on TLS servers and registered service domains.
+// Wildcard patterns cannot be probed and are left out.
+func ProbeHosts(sites []SiteInfo, services []ServiceConfig) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(h string) {
+		h = strings.ToLower(h)
+		if h == "" || strings.Contains(h, "*") || seen[h] {
+			return
+		}
+		seen[h] = true
+		hosts = append(hosts, h)
+	}
+	for _, s := range sites {
+		if s.TLS {
+			for _, h := range s.Hosts() {
+				add(h)
+			}
+		}
+	}
+	for _, svc := range services {
+		if svc.Scheme != "http" {
+			for _, h := range svc.DomainList() {
+				add(h)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// diskCertFor picks the on-disk cert that should serve host, the same way
+// BuildCoverage does: exact SAN first, then the one expiring last.
+func diskCertFor(host string, disk []CertInfo) (CertReference, bool) {
+	var best CertReference
+	bestExact, found := false, false
+	for _, c := range disk {
+		san, ok := certCovers(c, host)
+		if !ok {
+			continue
+		}
+		exact := strings.EqualFold(san, host)
+		if !found || (exact && !bestExact) || (exact == bestExact && c.NotAfter.After(best.NotAfter)) {
+			best = certReference(c)
+			best.MatchedSAN = san
+			bestExact, found = exact, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,221 @@
+package caddy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues leaf certificates for probe tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Probe Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a leaf for host valid for the given duration.
+func (ca *testCA) issue(t *testing.T, host string, valid time.Duration) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(valid),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// onDisk describes c as ReadExternalCerts would.
+func onDisk(c tls.Certificate) CertInfo {
+	return newCertInfo(c.Leaf.DNSNames[0], "external", []*x509.Certificate{c.Leaf})
+}
+
+// newSNIServer starts a TLS server that presents certs[SNI], the way
+// Caddy picks a certificate per hostname on one listener.
+func newSNIServer(t *testing.T, certs map[string]tls.Certificate) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c, ok := certs[hello.ServerName]
+			if !ok {
+				return nil, errors.New("no certificate for " + hello.ServerName)
+			}
+			return &c, nil
+		},
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+func TestProbe(t *testing.T) {
+	ca := newTestCA(t)
+	a := ca.issue(t, "a.test", 10*24*time.Hour)
+	b := ca.issue(t, "b.test", 10*24*time.Hour)
+	addr := newSNIServer(t, map[string]tls.Certificate{"a.test": a, "b.test": b})
+	p := &Prober{Addr: addr, Timeout: 2 * time.Second, RootCAs: ca.pool}
+
+	renewed := ca.issue(t, "a.test", 60*24*time.Hour)
+	older := ca.issue(t, "a.test", 5*24*time.Hour)
+
+	tests := []struct {
+		name   string
+		host   string
+		disk   []CertInfo
+		status string
+		domain string
+	}{
+		{"matching cert", "a.test", []CertInfo{onDisk(a), onDisk(b)}, ProbeMatch, "a.test"},
+		// The dial goes to addr; the host only travels as SNI.
+		{"sni picks the host's cert", "b.test", []CertInfo{onDisk(a), onDisk(b)}, ProbeMatch, "b.test"},
+		{"renewed on disk", "a.test", []CertInfo{onDisk(renewed)}, ProbeStale, "a.test"},
+		{"other cert on disk", "a.test", []CertInfo{onDisk(older)}, ProbeMismatch, "a.test"},
+		{"nothing on disk", "a.test", []CertInfo{onDisk(b)}, ProbeNotOnDisk, "a.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := p.Probe(context.Background(), tt.host, tt.disk)
+			if res.Status != tt.status {
+				t.Fatalf("status = %q (%s), want %q", res.Status, res.Error, tt.status)
+			}
+			if res.Presented == nil || res.Presented.Domain != tt.domain {
+				t.Fatalf("presented = %+v, want %s", res.Presented, tt.domain)
+			}
+			if !res.ChainValid || res.ChainError != "" {
+				t.Errorf("chain invalid: %s", res.ChainError)
+			}
+			if res.Protocol != "TLS 1.3" || res.ALPN != "http/1.1" {
+				t.Errorf("protocol %q alpn %q", res.Protocol, res.ALPN)
+			}
+			if res.Addr != addr {
+				t.Errorf("addr = %q, want %q", res.Addr, addr)
+			}
+		})
+	}
+}
+
+func TestProbeChainNotTrusted(t *testing.T) {
+	ca := newTestCA(t)
+	a := ca.issue(t, "a.test", 10*24*time.Hour)
+	addr := newSNIServer(t, map[string]tls.Certificate{"a.test": a})
+
+	// The system pool does not know the test CA: the cert is still
+	// compared, and the chain reported as invalid.
+	res := (&Prober{Addr: addr, Timeout: 2 * time.Second}).Probe(context.Background(), "a.test", []CertInfo{onDisk(a)})
+	if res.Status != ProbeMatch || res.ChainValid || res.ChainError == "" {
+		t.Errorf("got status %q, chainValid %v, chainError %q", res.Status, res.ChainValid, res.ChainError)
+	}
+
+	// A name the cert does not cover fails verification too.
+	other := ca.issue(t, "other.test", 10*24*time.Hour)
+	addr = newSNIServer(t, map[string]tls.Certificate{"a.test": other})
+	res = (&Prober{Addr: addr, Timeout: 2 * time.Second, RootCAs: ca.pool}).Probe(context.Background(), "a.test", nil)
+	if res.ChainValid || !strings.Contains(res.ChainError, "a.test") {
+		t.Errorf("chainValid %v, chainError %q; want a name mismatch", res.ChainValid, res.ChainError)
+	}
+}
+
+func TestProbeHandshakeFailure(t *testing.T) {
+	ca := newTestCA(t)
+	addr := newSNIServer(t, map[string]tls.Certificate{"a.test": ca.issue(t, "a.test", time.Hour)})
+	res := (&Prober{Addr: addr, Timeout: 2 * time.Second}).Probe(context.Background(), "unknown.test", nil)
+	if res.Status != ProbeError || res.Error == "" {
+		t.Errorf("got %+v, want a handshake error", res)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	// A listener that accepts but never answers the ClientHello.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	res := (&Prober{Addr: ln.Addr().String(), Timeout: 100 * time.Millisecond}).Probe(context.Background(), "a.test", nil)
+	if res.Status != ProbeError || !strings.Contains(res.Error, "deadline") {
+		t.Errorf("got status %q error %q, want a timeout", res.Status, res.Error)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("probe took %s with a 100ms timeout", d)
+	}
+}
+
+func TestProbeAllSortsByHost(t *testing.T) {
+	ca := newTestCA(t)
+	a, b := ca.issue(t, "a.test", time.Hour), ca.issue(t, "b.test", time.Hour)
+	addr := newSNIServer(t, map[string]tls.Certificate{"a.test": a, "b.test": b})
+	p := &Prober{Addr: addr, Timeout: 2 * time.Second, RootCAs: ca.pool}
+
+	res := p.ProbeAll(context.Background(), []string{"b.test", "a.test"}, []CertInfo{onDisk(a), onDisk(b)})
+	if len(res) != 2 || res[0].Host != "a.test" || res[1].Host != "b.test" {
+		t.Fatalf("results %+v", res)
+	}
+	for _, r := range res {
+		if r.Status != ProbeMatch {
+			t.Errorf("%s: %s %s", r.Host, r.Status, r.Error)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resolution is how Caddy would handle a request for a URL.
+type Resolution struct {
+	Server string `json:"server"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	// Chain lists every route whose matchers passed, in evaluation order.
+	Chain []RouteStep `json:"chain"`
+	// Handler is the handler that writes the response; "" means no route
+	// responded and Caddy would send an empty 200.
+	Handler string `json:"handler,omitempty"`
+	// Service names the svc-* route that answered, if any.
+	Service   string   `json:"service,omitempty"`
+	Upstream  string   `json:"upstream,omitempty"`
+	Upstreams []string `json:"upstreams,omitempty"`
+	Root      string   `json:"root,omitempty"`
+}
+
+// RouteStep is one matching route.
+type RouteStep struct {
+	// Depth is 0 for a server route and grows by one per subroute.
+	Depth int    `json:"depth"`
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	// Match is the matcher set that passed; empty when the route has none.
+	Match map[string]json.RawMessage `json:"match,omitempty"`
+	// Assumed lists matchers a URL alone cannot decide (method, header,
+	// remote_ip, ...). They are treated as matching.
+	Assumed  []string `json:"assumed,omitempty"`
+	Handlers []string `json:"handlers"`
+	Path     string   `json:"path"` // request path as the route saw it
+	Terminal bool     `json:"terminal,omitempty"`
+}
+
+// responders are the handlers that write a response instead of passing
+// the request on.
+var responders = map[string]bool{
+	"reverse_proxy":   true,
+	"file_server":     true,
+	"static_response": true,
+	"error":           true,
+	"acme_server":     true,
+}
+
+// resolveRoute keeps every matcher, unlike HTTPRoute.
+type resolveRoute struct {
+	ID       string                       `json:"@id,omitempty"`
+	Match    []map[string]json.RawMessage `json:"match"`
+	Handle   []json.RawMessage            `json:"handle"`
+	Terminal bool                         `json:"terminal"`
+}
+
+type resolveHandler struct {
+	Handler string         `json:"handler"`
+	Routes  []resolveRoute `json:"routes,omitempty"`
+	// rewrite
+	URI             string `json:"uri,omitempty"`
+	StripPathPrefix string `json:"strip_path_prefix,omitempty"`
+	StripPathSuffix string `json:"strip_path_suffix,omitempty"`
+}
+
+// Resolve walks cfg the way Caddy routes a request for rawURL: the server
+// listening on the URL's port, then its routes in order, descending into
+// subroutes, until a responder handles it or the routes run out. Rewrites
+// that change the path are applied to later matchers.
+func Resolve(cfg *CaddyConfig, rawURL string) (*Resolution, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("url must be absolute, e.g. https://app.example.com/api")
+	}
+	port := 443
+	if u.Scheme == "http" {
+		port = 80
+	} else if u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+	}
+
+	server, routes, err := serverFor(cfg, port)
+	if err != nil {
+		return nil, err
+	}
+	w := &walker{
+		scheme: u.Scheme,
+		host:   strings.ToLower(u.Hostname()),
+		path:   firstNonEmpty(u.Path, "/"),
+		res: &Resolution{
+			Server: server,
+			Host:   u.Hostname(),
+			Path:   firstNonEmpty(u.Path, "/"),
+			Chain:  []RouteStep{},
+		},
+	}
+	w.walk(routes, 0)
+	return w.res, nil
+}
+
+// serverFor returns the first server (by name) listening on port, with
+// its routes decoded for resolving.
+func serverFor(cfg *CaddyConfig, port int) (string, []resolveRoute, error) {
+	app, err := cfg.HTTP()
+	if err != nil {
+		return "", nil, err
+	}
+	names := make([]string, 0, len(app.Servers))
+	for name := range app.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !app.Servers[name].listensOn(port) {
+			continue
+		}
+		var servers struct {
+			Servers map[string]struct {
+				Routes []resolveRoute `json:"routes"`
+			} `json:"servers"`
+		}
+		if err := json.Unmarshal(cfg.Apps["http"], &servers); err != nil {
+			return "", nil, fmt.Errorf("parse http app: %w", err)
+		}
+		return name, servers.Servers[name].Routes, nil
+	}
+	return "", nil, fmt.Errorf("%w on port %d", ErrNoServer, port)
+}
+
+// ErrNoServer is returned by Resolve when no server listens on the URL's
+// port.
+var ErrNoServer = errors.New("no caddy server listens")
+
+type walker struct {
+	scheme, host, path string
+	res                *Resolution
+	service            string // svc-* route currently being walked
+}
+
+// walk evaluates routes like Caddy's compiled route list and reports
+// whether a responder handled the request.
+func (w *walker) walk(routes []resolveRoute, depth int) bool {
+	for i, r := range routes {
+		set, assumed, ok := w.match(r.Match)
+		if !ok {
+			continue
+		}
+		step := RouteStep{
+			Depth:    depth,
+			Index:    i,
+			ID:       r.ID,
+			Match:    set,
+			Assumed:  assumed,
+			Handlers: []string{},
+			Path:     w.path,
+			Terminal: r.Terminal,
+		}
+		for _, raw := range r.Handle {
+			var h resolveHandler
+			if json.Unmarshal(raw, &h) == nil {
+				step.Handlers = append(step.Handlers, h.Handler)
+			}
+		}
+		w.res.Chain = append(w.res.Chain, step)
+
+		outer := w.service
+		if name, ok := strings.CutPrefix(r.ID, ServiceRoutePrefix); ok {
+			w.service = name
+		}
+		if w.handle(r.Handle, depth) {
+			return true
+		}
+		w.service = outer
+		if r.Terminal {
+			return false
+		}
+	}
+	return false
+}
+
+// handle runs a route's handlers in order.
+func (w *walker) handle(handles []json.RawMessage, depth int) bool {
+	for _, raw := range handles {
+		var h resolveHandler
+		if err := json.Unmarshal(raw, &h); err != nil {
+			continue
+		}
+		switch {
+		case h.Handler == "subroute":
+			if w.walk(h.Routes, depth+1) {
+				return true
+			}
+		case h.Handler == "rewrite":
+			w.rewrite(h)
+		case responders[h.Handler]:
+			w.respond(h.Handler, raw)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *walker) rewrite(h resolveHandler) {
+	if h.URI != "" && !strings.Contains(h.URI, "{") {
+		if p, _, _ := strings.Cut(h.URI, "?"); p != "" {
+			w.path = p
+		}
+	}
+	if h.StripPathPrefix != "" {
+		prefix := "/" + strings.TrimPrefix(h.StripPathPrefix, "/")
+		if len(w.path) >= len(prefix) && strings.EqualFold(w.path[:len(prefix)], prefix) {
+			w.path = firstNonEmpty(w.path[len(prefix):], "/")
+			if !strings.HasPrefix(w.path, "/") {
+				w.path = "/" + w.path
+			}
+		}
+	}
+	if h.StripPathSuffix != "" {
+		w.path = firstNonEmpty(strings.TrimSuffix(w.path, h.StripPathSuffix), "/")
+	}
+}
+
+func (w *walker) respond(name string, raw json.RawMessage) {
+	var site SiteInfo
+	extractHandlerInfo(&site, []json.RawMessage{raw})
+	w.res.Handler = name
+	w.res.Service = w.service
+	w.res.Upstream = site.Upstream
+	w.res.Upstreams = site.Upstreams
+	w.res.Root = site.Root
+}
+
+// match applies Caddy's semantics: a route with no matcher sets matches
+// everything, otherwise any one set must match with all of its matchers.
+func (w *walker) match(sets []map[string]json.RawMessage) (map[string]json.RawMessage, []string, bool) {
+	if len(sets) == 0 {
+		return nil, nil, true
+	}
+	for _, set := range sets {
+		if assumed, ok := w.matchSet(set); ok {
+			return set, assumed, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (w *walker) matchSet(set map[string]json.RawMessage) ([]string, bool) {
+	var assumed []string
+	for name, raw := range set {
+		var ok bool
+		switch name {
+		case "host":
+			var hosts []string
+			_ = json.Unmarshal(raw, &hosts)
+			for _, h := range hosts {
+				ok = ok || hostMatches(h, w.host)
+			}
+		case "path":
+			var paths []string
+			_ = json.Unmarshal(raw, &paths)
+			for _, p := range paths {
+				ok = ok || pathMatches(p, w.path)
+			}
+		case "protocol":
+			var proto string
+			_ = json.Unmarshal(raw, &proto)
+			ok = strings.EqualFold(proto, w.scheme)
+		default:
+			ok = true
+			assumed = append(assumed, name)
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	sort.Strings(assumed)
+	return assumed, true
+}
+
+// pathMatches applies Caddy's path matcher: case-insensitive, exact
+// unless the pattern has "*", which may be a prefix ("/api/*"), suffix
+// ("*.css"), substring ("*/foo/*") or general glob.
+func pathMatches(pattern, p string) bool {
+	pattern = strings.ToLower(pattern)
+	p = strings.ToLower(p)
+	switch {
+	case !strings.Contains(pattern, "*"):
+		return pattern == p
+	case strings.Count(pattern, "*") == 1 && strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "*"))
+	case strings.Count(pattern, "*") == 1 && strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(p, strings.TrimPrefix(pattern, "*"))
+	case strings.Count(pattern, "*") == 2 && strings.HasPrefix(pattern, "*") && strings.HasSuffix(pattern, "*"):
+		return strings.Contains(p, pattern[1:len(pattern)-1])
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
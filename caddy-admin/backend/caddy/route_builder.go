@@ -1,34 +1,414 @@
 package caddy
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LBPolicies lists the supported reverse_proxy selection policies.
+var LBPolicies = []string{"round_robin", "least_conn", "ip_hash", "first"}
 
 // ServiceConfig describes a dynamically registered service.
 type ServiceConfig struct {
-	Name     string `json:"name"`
-	Domain   string `json:"domain"`
-	Upstream string `json:"upstream"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+	// Domains lists every hostname when the service has more than one:
+	// aliases and wildcard patterns such as "*.preview.example.com".
+	// Domain always mirrors Domains[0] for older clients.
+	Domains  []string `json:"domains,omitempty"`
+	Upstream string   `json:"upstream"`
+	// Upstreams lists every replica when the service has more than one.
+	// Upstream always mirrors Upstreams[0] for older clients.
+	Upstreams []string `json:"upstreams,omitempty"`
+	// LBPolicy is the selection policy across Upstreams (see LBPolicies).
+	LBPolicy string `json:"lbPolicy,omitempty"`
+	// Path optionally restricts the route to a path prefix, e.g. "/billing".
+	// A trailing "/*" is accepted and normalized away.
+	Path string `json:"path,omitempty"`
+	// StripPrefix removes Path from the request URI before proxying.
+	StripPrefix bool `json:"stripPrefix,omitempty"`
+	// HealthCheck enables active and passive upstream health checks.
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// TTL makes the registration a lease (Go duration, e.g. "60s"). The
+	// service is deregistered unless it heartbeats before ExpiresAt.
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Server pins the route to a named Caddy server (e.g. "srv1").
+	// Otherwise the server listening on Scheme/Port is used.
+	Server string `json:"server,omitempty"`
+	// Scheme ("http" or "https") and Port describe the listener the
+	// service is reached on. Port defaults to 443 or 80 by scheme; with
+	// neither set, an HTTPS server is preferred over an HTTP one.
+	Scheme string `json:"scheme,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	// Priority orders this service's route among svc-* routes; higher
+	// goes first. Ties are broken by specificity (see routeOrder).
+	Priority int `json:"priority,omitempty"`
+}
+
+// ListenPorts returns the ports whose server should carry the route, in
+// order of preference.
+func (svc ServiceConfig) ListenPorts() []int {
+	switch {
+	case svc.Port != 0:
+		return []int{svc.Port}
+	case svc.Scheme == "http":
+		return []int{80}
+	case svc.Scheme == "https":
+		return []int{443}
+	default:
+		return []int{443, 80}
+	}
+}
+
+// MinTTL is the shortest lease a service may request.
+const MinTTL = 5 * time.Second
+
+// RenewLease sets ExpiresAt to now+TTL, or clears it when TTL is unset.
+func (svc *ServiceConfig) RenewLease(now time.Time) {
+	svc.ExpiresAt = nil
+	if ttl, err := time.ParseDuration(svc.TTL); err == nil && svc.TTL != "" {
+		exp := now.Add(ttl).UTC()
+		svc.ExpiresAt = &exp
+	}
+}
+
+// Expired reports whether the service's lease ran out before now.
+func (svc ServiceConfig) Expired(now time.Time) bool {
+	return svc.ExpiresAt != nil && now.After(*svc.ExpiresAt)
+}
+
+// HealthCheck configures reverse_proxy health_checks for a service.
+// Durations use Go syntax ("10s", "1m"). An empty block `{}` probes
+// GET /health every 10s, which the sample backends already expose.
+type HealthCheck struct {
+	Path         string `json:"path,omitempty"`
+	Interval     string `json:"interval,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
+	ExpectStatus int    `json:"expectStatus,omitempty"`
+	// Passive checks: mark an upstream down after MaxFails failed
+	// requests within FailDuration.
+	FailDuration string `json:"failDuration,omitempty"`
+	MaxFails     int    `json:"maxFails,omitempty"`
+}
+
+// Health check defaults applied by Normalize.
+const (
+	DefaultHealthPath     = "/health"
+	DefaultHealthInterval = "10s"
+	DefaultHealthTimeout  = "5s"
+)
+
+// Normalize cleans up user-supplied fields in place.
+func (svc *ServiceConfig) Normalize() {
+	svc.Name = strings.TrimSpace(svc.Name)
+	svc.Path = normalizePath(svc.Path)
+	svc.LBPolicy = strings.ToLower(strings.TrimSpace(svc.LBPolicy))
+	svc.TTL = strings.TrimSpace(svc.TTL)
+	svc.Server = strings.TrimSpace(svc.Server)
+	svc.Scheme = strings.ToLower(strings.TrimSpace(svc.Scheme))
+
+	// Fold Domain and Domains, and Upstream and Upstreams, into
+	// de-duplicated lists.
+	var domains []string
+	for _, d := range append([]string{svc.Domain}, svc.Domains...) {
+		domains = append(domains, strings.ToLower(strings.TrimSpace(d)))
+	}
+	domains = dedupe(domains)
+	all := dedupe(append([]string{svc.Upstream}, svc.Upstreams...))
+	if hc := svc.HealthCheck; hc != nil {
+		hc.Path = strings.TrimSpace(hc.Path)
+		if hc.Path == "" {
+			hc.Path = DefaultHealthPath
+		}
+		if hc.Interval == "" {
+			hc.Interval = DefaultHealthInterval
+		}
+		if hc.Timeout == "" {
+			hc.Timeout = DefaultHealthTimeout
+		}
+	}
+
+	svc.Domain = ""
+	svc.Domains = nil
+	if len(domains) > 0 {
+		svc.Domain = domains[0]
+	}
+	if len(domains) > 1 {
+		svc.Domains = domains
+	}
+
+	svc.Upstream = ""
+	svc.Upstreams = nil
+	if len(all) > 0 {
+		svc.Upstream = all[0]
+	}
+	if len(all) > 1 {
+		svc.Upstreams = all
+	}
+}
+
+// dedupe trims values and drops blanks and repeats, keeping order.
+func dedupe(values []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// DomainList returns every hostname or pattern the service is served on.
+func (svc ServiceConfig) DomainList() []string {
+	if len(svc.Domains) > 0 {
+		return svc.Domains
+	}
+	if svc.Domain != "" {
+		return []string{svc.Domain}
+	}
+	return nil
+}
+
+// UpstreamList returns every dial address of the service.
+func (svc ServiceConfig) UpstreamList() []string {
+	if len(svc.Upstreams) > 0 {
+		return svc.Upstreams
+	}
+	if svc.Upstream != "" {
+		return []string{svc.Upstream}
+	}
+	return nil
+}
+
+// serviceName is the allowed form of a service name. Names end up in
+// admin API URLs (/id/svc-<name>) and are matched against token
+// prefixes, so they are limited to a DNS label.
+var serviceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidateName checks a service name.
+func ValidateName(name string) error {
+	if !serviceName.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: use 1-63 lowercase letters, digits and hyphens, starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// ValidateLegacyName checks a name stored before ValidateName was
+// enforced. Such services may still be updated and removed, so any name
+// Caddy can address as /id/svc-<name> is accepted.
+func ValidateLegacyName(name string) error {
+	if name == "" || strings.ContainsAny(name, "/?#% \t\r\n") {
+		return fmt.Errorf("invalid service name %q", name)
+	}
+	return nil
+}
+
+// Validate checks that the service can be turned into a Caddy route.
+func (svc ServiceConfig) Validate() error {
+	return svc.validate(ValidateName)
+}
+
+// ValidateLegacy is Validate for a service stored before names were
+// restricted: the name only has to pass ValidateLegacyName.
+func (svc ServiceConfig) ValidateLegacy() error {
+	return svc.validate(ValidateLegacyName)
+}
+
+func (svc ServiceConfig) validate(validName func(string) error) error {
+	if svc.Name == "" || len(svc.DomainList()) == 0 || len(svc.UpstreamList()) == 0 {
+		return errors.New("name, domain, and upstream are required")
+	}
+	if err := validName(svc.Name); err != nil {
+		return err
+	}
+	for _, d := range svc.DomainList() {
+		if err := validateHost(d); err != nil {
+			return err
+		}
+	}
+	for _, u := range svc.UpstreamList() {
+		if _, _, err := net.SplitHostPort(u); err != nil {
+			return fmt.Errorf("upstream %q must be host:port", u)
+		}
+	}
+	if svc.LBPolicy != "" && !contains(LBPolicies, svc.LBPolicy) {
+		return fmt.Errorf("lbPolicy must be one of %s", strings.Join(LBPolicies, ", "))
+	}
+	if svc.Path != "" {
+		if !strings.HasPrefix(svc.Path, "/") {
+			return errors.New("path must start with /")
+		}
+		if strings.ContainsAny(svc.Path, "*?[] ") {
+			return errors.New("path must be a plain prefix such as /billing or /billing/*")
+		}
+	}
+	if svc.StripPrefix && svc.Path == "" {
+		return errors.New("stripPrefix requires path")
+	}
+	if svc.Scheme != "" && svc.Scheme != "http" && svc.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if svc.Port < 0 || svc.Port > 65535 {
+		return errors.New("port must be between 1 and 65535")
+	}
+	if svc.TTL != "" {
+		if ttl, err := time.ParseDuration(svc.TTL); err != nil || ttl < MinTTL {
+			return fmt.Errorf("ttl must be a duration of at least %s", MinTTL)
+		}
+	}
+	if svc.HealthCheck != nil {
+		if err := svc.HealthCheck.validate(); err != nil {
+			return fmt.Errorf("healthCheck: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateHost accepts a hostname or a wildcard pattern whose "*" labels
+// each stand for exactly one label, as Caddy's host matcher does.
+func validateHost(d string) error {
+	if strings.ContainsAny(d, "/: ") {
+		return fmt.Errorf("domain %q must be a bare hostname such as app.example.com", d)
+	}
+	for _, label := range strings.Split(d, ".") {
+		if label == "" {
+			return fmt.Errorf("domain %q has an empty label", d)
+		}
+		if strings.Contains(label, "*") && label != "*" {
+			return fmt.Errorf("domain %q: a wildcard must be a whole label, e.g. *.example.com", d)
+		}
+	}
+	return nil
+}
+
+func (hc *HealthCheck) validate() error {
+	if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	for field, v := range map[string]string{
+		"interval":     hc.Interval,
+		"timeout":      hc.Timeout,
+		"failDuration": hc.FailDuration,
+	} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration like 10s", field)
+		}
+	}
+	if hc.ExpectStatus != 0 && (hc.ExpectStatus < 100 || hc.ExpectStatus > 599) {
+		return errors.New("expectStatus must be an HTTP status code")
+	}
+	if hc.MaxFails < 0 {
+		return errors.New("maxFails must not be negative")
+	}
+	if hc.MaxFails > 0 && hc.FailDuration == "" {
+		return errors.New("maxFails requires failDuration")
+	}
+	return nil
+}
+
+// caddyConfig renders the reverse_proxy "health_checks" block.
+func (hc *HealthCheck) caddyConfig() map[string]any {
+	active := map[string]any{"uri": hc.Path}
+	if hc.Interval != "" {
+		active["interval"] = hc.Interval
+	}
+	if hc.Timeout != "" {
+		active["timeout"] = hc.Timeout
+	}
+	if hc.ExpectStatus != 0 {
+		active["expect_status"] = hc.ExpectStatus
+	}
+	checks := map[string]any{"active": active}
+
+	if hc.FailDuration != "" || hc.MaxFails > 0 {
+		passive := map[string]any{}
+		if hc.FailDuration != "" {
+			passive["fail_duration"] = hc.FailDuration
+		}
+		if hc.MaxFails > 0 {
+			passive["max_fails"] = hc.MaxFails
+		}
+		checks["passive"] = passive
+	}
+	return checks
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePath turns "/billing/*", "/billing/" and "billing" into "/billing".
+// The root path "/" means no restriction and becomes "".
+func normalizePath(p string) string {
+	p = strings.TrimSpace(p)
+	p = strings.TrimSuffix(p, "*")
+	p = strings.TrimRight(p, "/")
+	if p != "" && !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
 }
 
 // BuildCaddyRoute generates a Caddy JSON route with @id for a service.
-// The route matches the service domain and reverse-proxies to the upstream.
+// The route matches the service domains in one host matcher (and path
+// prefix, if any) and reverse-proxies to the upstream.
 func BuildCaddyRoute(svc ServiceConfig) json.RawMessage {
+	match := map[string]any{"host": svc.DomainList()}
+	if svc.Path != "" {
+		match["path"] = []string{svc.Path, svc.Path + "/*"}
+	}
+
+	var handle []map[string]any
+	if svc.StripPrefix && svc.Path != "" {
+		handle = append(handle, map[string]any{
+			"handler":           "rewrite",
+			"strip_path_prefix": svc.Path,
+		})
+	}
+	var upstreams []map[string]string
+	for _, u := range svc.UpstreamList() {
+		upstreams = append(upstreams, map[string]string{"dial": u})
+	}
+	proxy := map[string]any{
+		"handler":   "reverse_proxy",
+		"upstreams": upstreams,
+	}
+	if svc.LBPolicy != "" {
+		proxy["load_balancing"] = map[string]any{
+			"selection_policy": map[string]string{"policy": svc.LBPolicy},
+		}
+	}
+	if svc.HealthCheck != nil {
+		proxy["health_checks"] = svc.HealthCheck.caddyConfig()
+	}
+	handle = append(handle, proxy)
+
 	route := map[string]any{
-		"@id": "svc-" + svc.Name,
-		"match": []map[string]any{
-			{"host": []string{svc.Domain}},
-		},
+		"@id":   "svc-" + svc.Name,
+		"match": []map[string]any{match},
 		"handle": []map[string]any{
 			{
 				"handler": "subroute",
 				"routes": []map[string]any{
-					{
-						"handle": []map[string]any{
-							{
-								"handler":   "reverse_proxy",
-								"upstreams": []map[string]string{{"dial": svc.Upstream}},
-							},
-						},
-					},
+					{"handle": handle},
 				},
 			},
 		},
@@ -0,0 +1,42 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	valid := []string{"api", "proj-a-web", "0day", strings.Repeat("a", 63)}
+	invalid := []string{"", "-api", "API", "proj-a/../x", "a?b", "a#b", "a b", "a.b", "a_b", strings.Repeat("a", 64)}
+	for _, name := range valid {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) = nil, want error", name)
+		}
+	}
+
+	svc := ServiceConfig{Name: "proj-a/../x", Domain: "x.test", Upstream: "x:80"}
+	if err := svc.Validate(); err == nil {
+		t.Error("Validate accepted a name with a path")
+	}
+	if err := svc.ValidateLegacy(); err == nil {
+		t.Error("ValidateLegacy accepted a name with a path")
+	}
+}
+
+func TestValidateLegacyName(t *testing.T) {
+	for _, name := range []string{"API", "a_b", "a.b", "Proj-A"} {
+		if err := ValidateLegacyName(name); err != nil {
+			t.Errorf("ValidateLegacyName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", "a/b", "a?b", "a#b", "a%2fb", "a b"} {
+		if err := ValidateLegacyName(name); err == nil {
+			t.Errorf("ValidateLegacyName(%q) = nil, want error", name)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTP decodes the http app of cfg. A config without one has no servers.
+func (cfg *CaddyConfig) HTTP() (HTTPApp, error) {
+	var app HTTPApp
+	raw, ok := cfg.Apps["http"]
+	if !ok {
+		return app, nil
+	}
+	if err := json.Unmarshal(raw, &app); err != nil {
+		return app, fmt.Errorf("parse http app: %w", err)
+	}
+	return app, nil
+}
+
+// SelectServer picks the server a service's route belongs on: svc.Server
+// or preferred when set, otherwise the first server (by name) whose
+// listen addresses include one of svc.ListenPorts().
+func (app HTTPApp) SelectServer(svc ServiceConfig, preferred string) (string, error) {
+	if name := firstNonEmpty(svc.Server, preferred); name != "" {
+		if _, ok := app.Servers[name]; !ok {
+			return "", fmt.Errorf("caddy server %q not found", name)
+		}
+		return name, nil
+	}
+	if len(app.Servers) == 0 {
+		return "", errors.New("caddy has no http servers")
+	}
+
+	names := make([]string, 0, len(app.Servers))
+	for name := range app.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ports := svc.ListenPorts()
+	for _, port := range ports {
+		for _, name := range names {
+			if app.Servers[name].listensOn(port) {
+				return name, nil
+			}
+		}
+	}
+	var want []string
+	for _, p := range ports {
+		want = append(want, strconv.Itoa(p))
+	}
+	return "", fmt.Errorf("no caddy server listens on port %s; set server explicitly", strings.Join(want, " or "))
+}
+
+// findRoute returns the server and index of the top-level route with the
+// given @id, or "" and -1.
+func (app HTTPApp) findRoute(id string) (string, int) {
+	for name, server := range app.Servers {
+		for i, r := range server.Routes {
+			if r.ID == id {
+				return name, i
+			}
+		}
+	}
+	return "", -1
+}
+
+// listensOn reports whether any listen address of s includes port.
+func (s HTTPServer) listensOn(port int) bool {
+	for _, addr := range s.Listen {
+		if lo, hi, ok := listenPortRange(addr); ok && port >= lo && port <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// servesTLS reports whether s terminates TLS: it has connection policies
+// or listens on 443, where Caddy enables them automatically.
+func (s HTTPServer) servesTLS() bool {
+	return len(s.TLSConnectionPolicies) > 0 || s.listensOn(443)
+}
+
+// listenPortRange parses a Caddy network address such as ":443",
+// "tcp/0.0.0.0:80" or "[::]:8000-8010". Unix sockets have no port.
+func listenPortRange(addr string) (int, int, bool) {
+	if network, rest, ok := strings.Cut(addr, "/"); ok {
+		if strings.HasPrefix(network, "unix") {
+			return 0, 0, false
+		}
+		addr = rest
+	}
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return 0, 0, false
+	}
+	lo, hi, isRange := strings.Cut(addr[i+1:], "-")
+	if !isRange {
+		hi = lo
+	}
+	start, err1 := strconv.Atoi(lo)
+	end, err2 := strconv.Atoi(hi)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// routePlan is where a service's route belongs.
+type routePlan struct {
+	server string // target server
+	// index is the route's position in the target server once placed,
+	// counted without the route itself.
+	index int
+	// current and currentIndex locate the existing route ("" if none).
+	current      string
+	currentIndex int
+}
+
+// inPlace reports whether the existing route is already where it belongs.
+func (p routePlan) inPlace() bool {
+	return p.current == p.server && p.currentIndex == p.index
+}
+
+// planRoute works out where svc's route goes in app.
+func (c *Client) planRoute(app HTTPApp, svc ServiceConfig) (routePlan, error) {
+	target, err := app.SelectServer(svc, c.server)
+	if err != nil {
+		return routePlan{}, err
+	}
+	peers, err := c.peers()
+	if err != nil {
+		return routePlan{}, err
+	}
+
+	p := routePlan{server: target}
+	p.current, p.currentIndex = app.findRoute(ServiceRoutePrefix + svc.Name)
+	routes := app.Servers[target].Routes
+	if p.current == target {
+		routes = append(routes[:p.currentIndex:p.currentIndex], routes[p.currentIndex+1:]...)
+	}
+	p.index = insertIndex(routes, svc, peers)
+	return p, nil
+}
+
+// insertIndex returns where a new route for svc goes in routes. svc-*
+// routes are kept in routeOrder; any other route that could also match
+// the service's requests (the same host, a wildcard covering it, or no
+// host matcher at all) stays behind it, so catch-alls never shadow it.
+// Otherwise it goes last.
+func insertIndex(routes []HTTPRoute, svc ServiceConfig, peers map[string]ServiceConfig) int {
+	me := orderOf(svc)
+	for i, r := range routes {
+		if name, ok := strings.CutPrefix(r.ID, ServiceRoutePrefix); ok {
+			if me.before(peerOrder(name, r, peers)) {
+				return i
+			}
+			continue
+		}
+		for _, d := range svc.DomainList() {
+			if routeCoversHost(r, d) {
+				return i
+			}
+		}
+	}
+	return len(routes)
+}
+
+// routeOrder ranks svc-* routes: higher priority first, then exact hosts
+// before wildcards (a service with any wildcard domain counts as one),
+// then longer paths before shorter, then by name.
+type routeOrder struct {
+	priority int
+	wildcard bool
+	pathLen  int
+	name     string
+}
+
+func orderOf(svc ServiceConfig) routeOrder {
+	o := routeOrder{priority: svc.Priority, pathLen: len(svc.Path), name: svc.Name}
+	for _, d := range svc.DomainList() {
+		o.wildcard = o.wildcard || strings.Contains(d, "*")
+	}
+	return o
+}
+
+// peerOrder ranks an existing svc-* route by its stored service, or by
+// its matchers if the service is not stored.
+func peerOrder(name string, r HTTPRoute, peers map[string]ServiceConfig) routeOrder {
+	if svc, ok := peers[name]; ok {
+		return orderOf(svc)
+	}
+	o := routeOrder{name: name}
+	for _, m := range r.Match {
+		for _, h := range m.Host {
+			o.wildcard = o.wildcard || strings.Contains(h, "*")
+		}
+		for _, p := range m.Path {
+			o.pathLen = max(o.pathLen, len(normalizePath(p)))
+		}
+	}
+	return o
+}
+
+func (a routeOrder) before(b routeOrder) bool {
+	switch {
+	case a.priority != b.priority:
+		return a.priority > b.priority
+	case a.wildcard != b.wildcard:
+		return !a.wildcard
+	case a.pathLen != b.pathLen:
+		return a.pathLen > b.pathLen
+	default:
+		return a.name < b.name
+	}
+}
+
+func routeCoversHost(r HTTPRoute, host string) bool {
+	if len(r.Match) == 0 {
+		return true
+	}
+	for _, m := range r.Match {
+		if len(m.Host) == 0 {
+			return true
+		}
+		for _, pattern := range m.Host {
+			if hostMatches(pattern, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hostMatches applies Caddy's host matcher rules: case-insensitive, and
+// "*" in a pattern label matches exactly one label of host.
+func hostMatches(pattern, host string) bool {
+	if strings.EqualFold(pattern, host) {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+	pl := strings.Split(strings.ToLower(pattern), ".")
+	hl := strings.Split(strings.ToLower(host), ".")
+	if len(pl) != len(hl) {
+		return false
+	}
+	for i := range pl {
+		if pl[i] != "*" && pl[i] != hl[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -14,12 +14,14 @@ type HTTPApp struct {
 
 // HTTPServer is a single HTTP server (srv0, srv1, ...)
 type HTTPServer struct {
-	Listen []string    `json:"listen"`
-	Routes []HTTPRoute `json:"routes"`
+	Listen                []string          `json:"listen"`
+	Routes                []HTTPRoute       `json:"routes"`
+	TLSConnectionPolicies []json.RawMessage `json:"tls_connection_policies,omitempty"`
 }
 
 // HTTPRoute is one route entry (match + handle)
 type HTTPRoute struct {
+	ID       string            `json:"@id,omitempty"`
 	Match    []MatchRule       `json:"match"`
 	Handle   []json.RawMessage `json:"handle"`
 	Terminal bool              `json:"terminal"`
@@ -33,15 +35,16 @@ type MatchRule struct {
 
 // Handler is decoded by "handler" field
 type Handler struct {
-	Handler   string          `json:"handler"`
+	Handler string `json:"handler"`
 	// subroute
-	Routes    []HTTPRoute     `json:"routes,omitempty"`
+	Routes []HTTPRoute `json:"routes,omitempty"`
 	// file_server
-	Root      string          `json:"root,omitempty"`
+	Root string `json:"root,omitempty"`
 	// reverse_proxy
-	Upstreams []Upstream      `json:"upstreams,omitempty"`
+	Upstreams     []Upstream     `json:"upstreams,omitempty"`
+	LoadBalancing *LoadBalancing `json:"load_balancing,omitempty"`
 	// headers
-	Response  *HeadersOps     `json:"response,omitempty"`
+	Response *HeadersOps `json:"response,omitempty"`
 	// encode
 	Encodings map[string]interface{} `json:"encodings,omitempty"`
 }
@@ -51,6 +54,23 @@ type Upstream struct {
 	Dial string `json:"dial"`
 }
 
+// UpstreamStatus is one entry of GET /reverse_proxy/upstreams
+type UpstreamStatus struct {
+	Address     string `json:"address"`
+	NumRequests int    `json:"num_requests"`
+	Fails       int    `json:"fails"`
+}
+
+// LoadBalancing is the reverse_proxy load_balancing block
+type LoadBalancing struct {
+	SelectionPolicy *SelectionPolicy `json:"selection_policy,omitempty"`
+}
+
+// SelectionPolicy names the upstream selection policy (round_robin, ...)
+type SelectionPolicy struct {
+	Policy string `json:"policy"`
+}
+
 // HeadersOps is the headers handler response config
 type HeadersOps struct {
 	Set    map[string][]string `json:"set"`
@@ -70,6 +90,6 @@ type TLSAutomation struct {
 
 // TLSPolicy holds a list of subjects to automate
 type TLSPolicy struct {
-	Subjects []string `json:"subjects"`
+	Subjects []string          `json:"subjects"`
 	Issuers  []json.RawMessage `json:"issuers,omitempty"`
 }
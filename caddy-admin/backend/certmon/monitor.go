@@ -0,0 +1,311 @@
+package certmon
+
+import (
+	"caddy-admin/caddy"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultThresholds are the days-left marks that trigger an alert.
+var DefaultThresholds = []int{30, 14, 7, 1}
+
+// Config controls the monitor.
+type Config struct {
+	// Interval between certificate scans.
+	Interval time.Duration
+	// Thresholds in days. A certificate alerts once per threshold it
+	// crosses, and once more when it expires.
+	Thresholds []int
+	// StateFile keeps what was already sent across restarts ("" = memory).
+	StateFile string
+	// NotifyTimeout bounds each delivery (default 30s).
+	NotifyTimeout time.Duration
+}
+
+// Alert is one certificate crossing a threshold.
+type Alert struct {
+	Domain   string    `json:"domain"`
+	Issuer   string    `json:"issuer"`
+	Source   string    `json:"source"`
+	NotAfter time.Time `json:"notAfter"`
+	DaysLeft int       `json:"daysLeft"`
+	// Threshold is the days mark that was crossed; 0 once expired.
+	Threshold int  `json:"threshold"`
+	Expired   bool `json:"expired"`
+	// Test marks alerts sent by SendTest.
+	Test bool `json:"test,omitempty"`
+}
+
+// Summary is a one-line description of the alert.
+func (a Alert) Summary() string {
+	switch {
+	case a.Test:
+		return fmt.Sprintf("caddy-admin test alert for %s (expires %s)", a.Domain, a.NotAfter.Format(time.DateOnly))
+	case a.Expired:
+		return fmt.Sprintf("Certificate for %s expired on %s", a.Domain, a.NotAfter.Format(time.DateOnly))
+	default:
+		return fmt.Sprintf("Certificate for %s expires in %d days (%s, issuer %s)",
+			a.Domain, a.DaysLeft, a.NotAfter.Format(time.DateOnly), a.Issuer)
+	}
+}
+
+// Notifier delivers alerts somewhere.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Status is the outcome of the most recent scan.
+type Status struct {
+	Running    bool      `json:"running"`
+	Thresholds []int     `json:"thresholds"`
+	Notifiers  []string  `json:"notifiers"`
+	LastRun    time.Time `json:"lastRun"`
+	// Alerting lists certificates currently inside a threshold.
+	Alerting  []Alert   `json:"alerting"`
+	LastSent  time.Time `json:"lastSent"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Monitor scans certificates on an interval and notifies when one crosses
+// a threshold. Each notifier keeps its own de-duplication state, so a
+// failing one is retried on the next scan without repeating the others;
+// a renewed certificate (new NotAfter) starts over.
+type Monitor struct {
+	certs     func() []caddy.CertInfo
+	cfg       Config
+	notifiers []Notifier
+
+	// check serializes scans so two never deliver the same alert. mu only
+	// guards the state below and is never held while a notifier runs.
+	check sync.Mutex
+	mu    sync.Mutex
+	// sent maps notifier name and certificate to the lowest threshold
+	// already delivered.
+	sent   map[string]int
+	status Status
+}
+
+// New creates a Monitor reading certificates from certs and loads its
+// state file, if any.
+func New(certs func() []caddy.CertInfo, cfg Config, notifiers ...Notifier) (*Monitor, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.NotifyTimeout <= 0 {
+		cfg.NotifyTimeout = 30 * time.Second
+	}
+	if len(cfg.Thresholds) == 0 {
+		cfg.Thresholds = DefaultThresholds
+	}
+	cfg.Thresholds = append([]int(nil), cfg.Thresholds...)
+	sort.Sort(sort.Reverse(sort.IntSlice(cfg.Thresholds)))
+
+	m := &Monitor{certs: certs, cfg: cfg, notifiers: notifiers, sent: map[string]int{}}
+	m.status.Thresholds = cfg.Thresholds
+	m.status.Notifiers = []string{}
+	for _, n := range notifiers {
+		m.status.Notifiers = append(m.status.Notifiers, n.Name())
+	}
+	m.status.Alerting = []Alert{}
+
+	if cfg.StateFile != "" {
+		data, err := os.ReadFile(cfg.StateFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(data, &m.sent); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", cfg.StateFile, err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Status returns a snapshot of the last scan.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.status
+	s.Alerting = append([]Alert(nil), m.status.Alerting...)
+	return s
+}
+
+// Run scans until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	m.update(func(s *Status) { s.Running = true })
+	defer m.update(func(s *Status) { s.Running = false })
+	for {
+		if err := m.Check(ctx, time.Now()); err != nil {
+			log.Printf("certmon: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.cfg.Interval):
+		}
+	}
+}
+
+// Check scans once and sends any alert not yet delivered. Alerts are
+// collected under the lock and sent without it, each within
+// Config.NotifyTimeout, so Status never waits on a slow notifier.
+func (m *Monitor) Check(ctx context.Context, now time.Time) error {
+	m.check.Lock()
+	defer m.check.Unlock()
+
+	type pending struct {
+		notifier Notifier
+		key      string
+		alert    Alert
+	}
+	alerting := []Alert{}
+	live := make(map[string]bool)
+	var todo []pending
+	certs := m.certs()
+	m.mu.Lock()
+	for _, c := range certs {
+		a, ok := m.alertFor(c, now)
+		if !ok {
+			continue
+		}
+		alerting = append(alerting, a)
+		for _, n := range m.notifiers {
+			key := stateKey(n.Name(), c)
+			live[key] = true
+			if last, ok := m.sent[key]; ok && last <= a.Threshold {
+				continue
+			}
+			todo = append(todo, pending{n, key, a})
+		}
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	delivered := make(map[string]int)
+	for _, p := range todo {
+		if err := m.notify(ctx, p.notifier, p.alert); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", p.notifier.Name(), p.alert.Domain, err))
+			continue
+		}
+		delivered[p.key] = p.alert.Threshold
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, threshold := range delivered {
+		m.sent[key] = threshold
+	}
+	// Forget renewed or removed certificates.
+	for key := range m.sent {
+		if !live[key] {
+			delete(m.sent, key)
+		}
+	}
+	saveErr := m.save()
+
+	m.status.LastRun = now
+	m.status.Alerting = alerting
+	if len(delivered) > 0 {
+		m.status.LastSent = now
+	}
+	err := errors.Join(append(errs, saveErr)...)
+	m.status.LastError = ""
+	if err != nil {
+		m.status.LastError = err.Error()
+	}
+	return err
+}
+
+// notify delivers a through n within Config.NotifyTimeout.
+func (m *Monitor) notify(ctx context.Context, n Notifier, a Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.NotifyTimeout)
+	defer cancel()
+	return n.Notify(ctx, a)
+}
+
+// SendTest sends a test alert to every notifier, so delivery can be
+// checked without waiting for a certificate to expire.
+func (m *Monitor) SendTest(ctx context.Context) map[string]string {
+	a := Alert{
+		Domain:    "test.example.com",
+		Issuer:    "caddy-admin",
+		Source:    "test",
+		NotAfter:  time.Now().Add(7 * 24 * time.Hour).UTC(),
+		DaysLeft:  7,
+		Threshold: 7,
+		Test:      true,
+	}
+	result := make(map[string]string, len(m.notifiers))
+	for _, n := range m.notifiers {
+		result[n.Name()] = "ok"
+		if err := m.notify(ctx, n, a); err != nil {
+			result[n.Name()] = err.Error()
+		}
+	}
+	return result
+}
+
+// alertFor returns the alert for c at its lowest crossed threshold.
+func (m *Monitor) alertFor(c caddy.CertInfo, now time.Time) (Alert, bool) {
+	days := int(c.NotAfter.Sub(now).Hours() / 24)
+	a := Alert{
+		Domain:    c.Domain,
+		Issuer:    c.Issuer,
+		Source:    c.Source,
+		NotAfter:  c.NotAfter,
+		DaysLeft:  days,
+		Threshold: -1,
+		Expired:   now.After(c.NotAfter),
+	}
+	if a.Expired {
+		a.Threshold = 0
+		return a, true
+	}
+	for _, t := range m.cfg.Thresholds {
+		if days <= t {
+			a.Threshold = t
+		}
+	}
+	return a, a.Threshold >= 0
+}
+
+// stateKey identifies a certificate for one notifier. NotAfter changes
+// on renewal, which resets the alerts for that domain.
+func stateKey(notifier string, c caddy.CertInfo) string {
+	return notifier + "|" + c.Source + "|" + c.Domain + "|" + c.NotAfter.UTC().Format(time.RFC3339)
+}
+
+func (m *Monitor) save() error {
+	if m.cfg.StateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.sent, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.cfg.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := m.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.cfg.StateFile)
+}
+
+func (m *Monitor) update(fn func(*Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.status)
+}
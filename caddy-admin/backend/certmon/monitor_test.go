@@ -0,0 +1,314 @@
+package certmon
+
+import (
+	"bufio"
+	"caddy-admin/caddy"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sink is an HTTP endpoint recording the JSON bodies posted to it.
+type sink struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]any
+	status int
+}
+
+func newSink(t *testing.T) *sink {
+	s := &sink{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("sink: %v", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status == http.StatusOK {
+			s.bodies = append(s.bodies, body)
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sink) received() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]any(nil), s.bodies...)
+}
+
+func (s *sink) fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// smtpServer is a minimal SMTP listener recording each message's data.
+type smtpServer struct {
+	addr string
+	mu   sync.Mutex
+	msgs []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.msgs = append(s.msgs, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func expiring(days int) []caddy.CertInfo {
+	return []caddy.CertInfo{{
+		Domain:   "a.example.com",
+		Issuer:   "R3",
+		Source:   "letsencrypt",
+		NotAfter: now.Add(time.Duration(days)*24*time.Hour + time.Hour),
+	}}
+}
+
+func TestCheckDeliversOncePerThreshold(t *testing.T) {
+	webhook, slack, mail := newSink(t), newSink(t), newSMTPServer(t)
+	certs := expiring(5)
+	m, err := New(func() []caddy.CertInfo { return certs }, Config{
+		StateFile: filepath.Join(t.TempDir(), "alerts.json"),
+	},
+		&Webhook{URL: webhook.URL},
+		&Slack{URL: slack.URL},
+		&SMTP{Addr: mail.addr, From: "caddy@example.com", To: []string{"ops@example.com"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Check(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := webhook.received(); len(got) != 1 || got[0]["threshold"] != float64(7) || got[0]["domain"] != "a.example.com" {
+		t.Errorf("webhook got %v, want one alert at threshold 7", got)
+	}
+	if got := slack.received(); len(got) != 1 || !strings.Contains(got[0]["text"].(string), "expires in 5 days") {
+		t.Errorf("slack got %v, want one alert", got)
+	}
+	if got := mail.received(); len(got) != 1 || !strings.Contains(got[0], "Subject: Certificate for a.example.com expires in 5 days") {
+		t.Errorf("smtp got %q, want one alert", got)
+	}
+
+	// The next threshold alerts again, once.
+	for i := 0; i < 2; i++ {
+		if err := m.Check(context.Background(), now.Add(4*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(webhook.received()); n != 2 {
+		t.Errorf("webhook got %d alerts, want 2", n)
+	}
+	if n := len(mail.received()); n != 2 {
+		t.Errorf("smtp got %d alerts, want 2", n)
+	}
+
+	// A restarted monitor remembers what was sent.
+	m2, err := New(func() []caddy.CertInfo { return certs }, m.cfg, m.notifiers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Check(context.Background(), now.Add(4*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(slack.received()); n != 2 {
+		t.Errorf("slack got %d alerts after restart, want 2", n)
+	}
+}
+
+func TestCheckRetriesOnlyFailedNotifier(t *testing.T) {
+	good, bad := newSink(t), newSink(t)
+	bad.fail(http.StatusInternalServerError)
+	m, err := New(func() []caddy.CertInfo { return expiring(5) }, Config{},
+		&Webhook{URL: good.URL}, &Slack{URL: bad.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Check(context.Background(), now); err == nil || !strings.Contains(err.Error(), "slack") {
+		t.Fatalf("err = %v, want slack failure", err)
+	}
+	if m.Status().LastError == "" {
+		t.Error("status does not report the failure")
+	}
+	bad.fail(http.StatusOK)
+	if err := m.Check(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(good.received()) != 1 || len(bad.received()) != 1 {
+		t.Errorf("webhook got %d, slack got %d; want 1 each", len(good.received()), len(bad.received()))
+	}
+}
+
+// blockingNotifier waits for release or its context.
+type blockingNotifier struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingNotifier) Name() string { return "blocking" }
+
+func (b *blockingNotifier) Notify(ctx context.Context, a Alert) error {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestStatusDoesNotWaitForNotifier(t *testing.T) {
+	n := &blockingNotifier{started: make(chan struct{}, 1), release: make(chan struct{})}
+	m, err := New(func() []caddy.CertInfo { return expiring(5) }, Config{}, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- m.Check(context.Background(), now) }()
+	<-n.started
+
+	status := make(chan Status)
+	go func() { status <- m.Status() }()
+	select {
+	case <-status:
+	case <-time.After(time.Second):
+		t.Fatal("Status blocked while a notifier was sending")
+	}
+	close(n.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := m.Status(); s.LastSent != now || len(s.Alerting) != 1 {
+		t.Errorf("status after send = %+v", s)
+	}
+}
+
+func TestCheckTimesOutNotifier(t *testing.T) {
+	n := &blockingNotifier{started: make(chan struct{}, 1), release: make(chan struct{})}
+	m, err := New(func() []caddy.CertInfo { return expiring(5) }, Config{NotifyTimeout: 50 * time.Millisecond}, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = m.Check(context.Background(), now)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Check took %s", d)
+	}
+	// Not recorded as sent: the next scan tries again.
+	<-n.started
+	close(n.release)
+	if err := m.Check(context.Background(), now); err != nil {
+		t.Errorf("retry: %v", err)
+	}
+	if s := m.Status(); s.LastSent != now {
+		t.Errorf("retry not delivered: %+v", s)
+	}
+}
+
+func TestSMTPTimesOut(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second) // never greets
+		}
+	}()
+
+	s := &SMTP{Addr: ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Notify(ctx, Alert{Domain: "a.example.com"}); err == nil {
+		t.Fatal("notify succeeded against a silent server")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("notify took %s, want it bounded by the context", d)
+	}
+}
@@ -0,0 +1,394 @@
+package certwatch
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/caddy"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of applying changed certificates.
+const (
+	OutcomeReloaded     = "reloaded"
+	OutcomeInvalid      = "invalid"       // files failed validation; Caddy untouched
+	OutcomeReloadFailed = "reload_failed" // Caddy rejected the reload
+	// OutcomeNotApplied means Caddy reloaded but still presents another
+	// cert for a covered host, e.g. its config does not load these files.
+	OutcomeNotApplied = "not_applied"
+)
+
+// Pair is a certificate file and the private key that matches it.
+type Pair struct {
+	Cert        string    `json:"cert"`
+	Key         string    `json:"key"`
+	Domain      string    `json:"domain"`
+	SANs        []string  `json:"sans"`
+	NotAfter    time.Time `json:"notAfter"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// Result is the outcome of one attempt to load the directory into Caddy.
+type Result struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"` // "startup", "change" or "manual"
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	Pairs   []Pair    `json:"pairs"`
+	// Probes show what Caddy presents afterwards for the covered hosts.
+	Probes []caddy.ProbeResult `json:"probes,omitempty"`
+}
+
+// Status is the watcher's state.
+type Status struct {
+	Running    bool      `json:"running"`
+	Dir        string    `json:"dir"`
+	Interval   string    `json:"interval"`
+	LastCheck  time.Time `json:"lastCheck"`
+	LastChange time.Time `json:"lastChange"`
+	Last       *Result   `json:"last,omitempty"`
+}
+
+// Watcher polls a directory of externally issued certificates (acme.sh
+// install-cert output) and, when its contents change, validates every
+// cert/key pair and makes Caddy reload them without a restart.
+type Watcher struct {
+	client   *caddy.Client
+	dir      string
+	interval time.Duration
+	// lock is shared with the services handler: a reload re-posts the
+	// current config and must not race a route change.
+	lock  sync.Locker
+	audit *audit.Log
+
+	prober *caddy.Prober
+	hosts  func() ([]string, error)
+
+	mu     sync.Mutex
+	hash   string
+	status Status
+}
+
+// New creates a Watcher for dir. lock may be nil when nothing else
+// mutates Caddy; auditLog may be nil.
+func New(client *caddy.Client, dir string, interval time.Duration, lock sync.Locker, auditLog *audit.Log) *Watcher {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if lock == nil {
+		lock = &sync.Mutex{}
+	}
+	return &Watcher{
+		client:   client,
+		dir:      dir,
+		interval: interval,
+		lock:     lock,
+		audit:    auditLog,
+		status:   Status{Dir: dir, Interval: interval.String()},
+	}
+}
+
+// UseProber verifies each reload with a TLS handshake for every host in
+// hosts() that the new certificates cover.
+func (w *Watcher) UseProber(p *caddy.Prober, hosts func() ([]string, error)) {
+	w.prober = p
+	w.hosts = hosts
+}
+
+// Status returns the watcher's state.
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Run polls until ctx is cancelled. It starts by comparing the directory
+// with what Caddy presents, so a renewal that landed while caddy-admin
+// was down is loaded too.
+func (w *Watcher) Run(ctx context.Context) {
+	w.update(func(s *Status) { s.Running = true })
+	defer w.update(func(s *Status) { s.Running = false })
+
+	hash, err := dirHash(w.dir)
+	if err != nil {
+		log.Printf("certwatch: %v", err)
+	}
+	w.mu.Lock()
+	w.hash = hash
+	w.status.LastCheck = time.Now()
+	w.mu.Unlock()
+	if res := w.startup(ctx); res != nil && res.Outcome != OutcomeReloaded {
+		log.Printf("certwatch: startup: %s: %s", res.Outcome, res.Error)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.interval):
+		}
+		if res := w.poll(ctx); res != nil && res.Outcome != OutcomeReloaded {
+			log.Printf("certwatch: %s: %s", res.Outcome, res.Error)
+		}
+	}
+}
+
+// startup applies the directory if Caddy presents an older certificate
+// than the one on disk for any covered host. Without a prober there is
+// nothing to compare with, and the files are assumed to be loaded.
+func (w *Watcher) startup(ctx context.Context) *Result {
+	if w.prober == nil {
+		return nil
+	}
+	disk := caddy.ReadExternalCerts(w.dir)
+	hosts, err := w.coveredHosts(disk)
+	if err != nil {
+		log.Printf("certwatch: startup: %v", err)
+		return nil
+	}
+	for _, p := range w.prober.ProbeAll(ctx, hosts, disk) {
+		if p.Status == caddy.ProbeStale {
+			res := w.Apply(ctx, "startup", audit.Entry{Actor: "certwatch"})
+			return &res
+		}
+	}
+	return nil
+}
+
+// poll applies the directory if it changed since the last poll.
+func (w *Watcher) poll(ctx context.Context) *Result {
+	hash, err := dirHash(w.dir)
+	now := time.Now()
+	w.mu.Lock()
+	w.status.LastCheck = now
+	changed := err == nil && hash != w.hash
+	if changed {
+		w.hash = hash
+		w.status.LastChange = now
+	}
+	w.mu.Unlock()
+	if err != nil {
+		log.Printf("certwatch: %v", err)
+		return nil
+	}
+	if !changed {
+		return nil
+	}
+	res := w.Apply(ctx, "change", audit.Entry{Actor: "certwatch"})
+	return &res
+}
+
+// Apply validates the directory and, if every pair is usable, reloads
+// Caddy and verifies the result. e carries the caller for the audit log.
+func (w *Watcher) Apply(ctx context.Context, trigger string, e audit.Entry) Result {
+	res := Result{Time: time.Now(), Trigger: trigger, Pairs: []Pair{}}
+	// A manual apply covers any change the next poll would find.
+	if hash, err := dirHash(w.dir); err == nil {
+		w.mu.Lock()
+		w.hash = hash
+		w.mu.Unlock()
+	}
+	pairs, err := LoadPairs(w.dir, res.Time)
+	res.Pairs = append(res.Pairs, pairs...)
+	switch {
+	case err != nil:
+		res.Outcome = OutcomeInvalid
+		res.Error = err.Error()
+	default:
+		w.lock.Lock()
+		err = w.client.Reload()
+		w.lock.Unlock()
+		if err != nil {
+			res.Outcome = OutcomeReloadFailed
+			res.Error = err.Error()
+		} else {
+			res.Outcome = OutcomeReloaded
+			w.verify(ctx, &res)
+		}
+	}
+
+	e.Action = audit.ActionCertReload
+	e.Target = w.dir
+	e.Success = res.Outcome == OutcomeReloaded
+	e.Error = res.Error
+	e.Details = map[string]any{"trigger": trigger, "outcome": res.Outcome, "pairs": res.Pairs}
+	if res.Outcome != OutcomeInvalid {
+		e.Caddy = "ok"
+		if res.Outcome == OutcomeReloadFailed {
+			e.Caddy = res.Error
+		}
+	}
+	if err := w.audit.Record(e); err != nil {
+		log.Printf("audit: %v", err)
+	}
+
+	w.update(func(s *Status) { s.Last = &res })
+	return res
+}
+
+// verify probes the hosts covered by the new pairs and downgrades the
+// outcome if Caddy still presents something else.
+func (w *Watcher) verify(ctx context.Context, res *Result) {
+	if w.prober == nil {
+		return
+	}
+	disk := caddy.ReadExternalCerts(w.dir)
+	hosts, err := w.coveredHosts(disk)
+	if err != nil {
+		res.Error = "verify: " + err.Error()
+		return
+	}
+	res.Probes = w.prober.ProbeAll(ctx, hosts, disk)
+	var stale []string
+	for _, p := range res.Probes {
+		if p.Status != caddy.ProbeMatch {
+			stale = append(stale, fmt.Sprintf("%s (%s)", p.Host, p.Status))
+		}
+	}
+	if len(stale) > 0 {
+		res.Outcome = OutcomeNotApplied
+		res.Error = "caddy does not present the new certificate for " + strings.Join(stale, ", ") +
+			"; check that its config loads these files"
+	}
+}
+
+// coveredHosts returns the hosts from w.hosts that a cert in disk covers.
+func (w *Watcher) coveredHosts(disk []caddy.CertInfo) ([]string, error) {
+	all, err := w.hosts()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, h := range all {
+		for _, c := range disk {
+			if c.Covers(h) {
+				hosts = append(hosts, h)
+				break
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// LoadPairs matches every certificate in dir with its private key and
+// checks that each leaf is valid at now. Key files are those whose name
+// contains "key"; certificates are the other .pem, .crt and .cer files.
+// Files holding only CA certificates (ca.pem, chain.pem) have no key of
+// their own and are skipped.
+func LoadPairs(dir string, now time.Time) ([]Pair, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var certs, keys []string
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir() || strings.HasPrefix(name, "."):
+		case strings.Contains(name, "key"):
+			keys = append(keys, name)
+		case strings.HasSuffix(name, ".pem") || strings.HasSuffix(name, ".crt") || strings.HasSuffix(name, ".cer"):
+			certs = append(certs, name)
+		}
+	}
+	var pairs []Pair
+	var errs []error
+	for _, name := range certs {
+		p, err := loadPair(dir, name, keys, now)
+		switch {
+		case errors.Is(err, caddy.ErrChainOnly):
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		default:
+			pairs = append(pairs, p)
+		}
+	}
+	if len(pairs) == 0 && len(errs) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", dir)
+	}
+	return pairs, errors.Join(errs...)
+}
+
+func loadPair(dir, name string, keys []string, now time.Time) (Pair, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return Pair{}, err
+	}
+	// The same leaf rule as ReadExternalCerts, so the certs list, the
+	// expiry monitor and the coverage report see what is reloaded here.
+	chain, err := caddy.ParseBundle(certPEM)
+	if err != nil {
+		return Pair{}, err
+	}
+	leaf := chain[0]
+	for _, key := range keys {
+		keyPEM, err := os.ReadFile(filepath.Join(dir, key))
+		if err != nil {
+			continue
+		}
+		// Caddy's load_pem pairs the key with the file's first certificate.
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			continue
+		}
+		switch {
+		case now.Before(leaf.NotBefore):
+			return Pair{}, fmt.Errorf("not valid until %s", leaf.NotBefore.Format(time.RFC3339))
+		case now.After(leaf.NotAfter):
+			return Pair{}, fmt.Errorf("expired on %s", leaf.NotAfter.Format(time.RFC3339))
+		}
+		p := Pair{
+			Cert:        name,
+			Key:         key,
+			Domain:      leaf.Subject.CommonName,
+			SANs:        leaf.DNSNames,
+			NotAfter:    leaf.NotAfter,
+			Fingerprint: caddy.Fingerprint(leaf),
+		}
+		if len(leaf.DNSNames) > 0 {
+			p.Domain = leaf.DNSNames[0]
+		}
+		return p, nil
+	}
+	return Pair{}, errors.New("no matching private key")
+}
+
+// dirHash fingerprints the contents of the regular files in dir.
+func dirHash(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (w *Watcher) update(fn func(*Status)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn(&w.status)
+}
@@ -0,0 +1,222 @@
+package certwatch
+
+import (
+	"caddy-admin/caddy"
+	"caddy-admin/caddy/caddytest"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the watcher tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool,
+		pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a leaf for host and its key, both PEM encoded.
+func (ca *testCA) issue(t *testing.T, host string, valid time.Duration) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(valid),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFiles(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func join(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestLoadPairsSkipsChainFiles(t *testing.T) {
+	ca, root := newTestCA(t, "Intermediate"), newTestCA(t, "Root")
+	cert, key := ca.issue(t, "a.test", 30*24*time.Hour)
+
+	dir := writeFiles(t, map[string][]byte{
+		"cert.pem":      cert,
+		"fullchain.pem": join(cert, ca.pem),
+		"key.pem":       key,
+		"ca.pem":        ca.pem,
+		"chain.pem":     join(ca.pem, root.pem),
+	})
+	pairs, err := LoadPairs(dir, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range pairs {
+		names = append(names, p.Cert)
+		if p.Key != "key.pem" || p.Domain != "a.test" {
+			t.Errorf("pair %+v", p)
+		}
+	}
+	if strings.Join(names, ",") != "cert.pem,fullchain.pem" {
+		t.Errorf("pairs for %v, want cert.pem and fullchain.pem", names)
+	}
+}
+
+func TestLoadPairsRejects(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	cert, key := ca.issue(t, "a.test", 30*24*time.Hour)
+	other, _ := ca.issue(t, "b.test", 30*24*time.Hour)
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		want  string
+	}{
+		{"leaf without key", map[string][]byte{"cert.pem": cert, "key.pem": key, "b.pem": other}, "b.pem: no matching private key"},
+		{"chain files only", map[string][]byte{"ca.pem": ca.pem}, "no certificates"},
+		{"leaf mixed into chain file", map[string][]byte{"cert.pem": cert, "key.pem": key, "chain.pem": join(ca.pem, other)}, "chain.pem: no matching private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadPairs(writeFiles(t, tt.files), time.Now())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// serveCert starts a TLS server presenting certPEM/keyPEM for any SNI.
+func serveCert(t *testing.T, certPEM, keyPEM []byte) string {
+	t.Helper()
+	kp, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{kp}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+func TestStartupReloadsRenewalMissedWhileDown(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	servedCert, servedKey := ca.issue(t, "a.test", 10*24*time.Hour)
+	renewedCert, renewedKey := ca.issue(t, "a.test", 90*24*time.Hour)
+
+	tests := []struct {
+		name       string
+		disk       map[string][]byte
+		wantReload bool
+	}{
+		{"renewed on disk", map[string][]byte{"cert.pem": renewedCert, "key.pem": renewedKey, "ca.pem": ca.pem}, true},
+		{"already served", map[string][]byte{"cert.pem": servedCert, "key.pem": servedKey}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := caddytest.NewServer(t, "")
+			w := New(caddy.NewClient(fake.Addr()), writeFiles(t, tt.disk), time.Hour, nil, nil)
+			w.UseProber(&caddy.Prober{Addr: serveCert(t, servedCert, servedKey), Timeout: 2 * time.Second, RootCAs: ca.pool},
+				func() ([]string, error) { return []string{"a.test", "other.test"}, nil })
+
+			res := w.startup(context.Background())
+			if got := len(fake.Loads()) > 0; got != tt.wantReload {
+				t.Fatalf("reloaded = %v, want %v", got, tt.wantReload)
+			}
+			if !tt.wantReload {
+				if res != nil {
+					t.Errorf("result %+v, want none", res)
+				}
+				return
+			}
+			if res == nil || res.Trigger != "startup" || len(res.Pairs) != 1 {
+				t.Fatalf("result %+v, want a startup reload of one pair", res)
+			}
+			// The fake does not reload certificates, so the probe afterwards
+			// still sees the old one.
+			if res.Outcome != OutcomeNotApplied || len(res.Probes) != 1 || res.Probes[0].Host != "a.test" {
+				t.Errorf("outcome %q, probes %+v", res.Outcome, res.Probes)
+			}
+			if s := w.Status(); s.Last == nil || s.Last.Trigger != "startup" {
+				t.Errorf("status %+v", s)
+			}
+		})
+	}
+}
+
+func TestStartupWithoutProber(t *testing.T) {
+	fake := caddytest.NewServer(t, "")
+	w := New(caddy.NewClient(fake.Addr()), t.TempDir(), time.Hour, nil, nil)
+	if res := w.startup(context.Background()); res != nil || len(fake.Loads()) != 0 {
+		t.Errorf("startup without prober: %+v, %d loads", res, len(fake.Loads()))
+	}
+}
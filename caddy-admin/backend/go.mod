@@ -1,3 +1,15 @@
 module caddy-admin
 
 go 1.22
+
+require (
+	github.com/coreos/go-oidc/v3 v3.11.0
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/oauth2 v0.21.0
+)
+
+require (
+	github.com/go-jose/go-jose/v4 v4.0.2 // indirect
+	golang.org/x/crypto v0.25.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)
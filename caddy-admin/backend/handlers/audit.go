@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/auth"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditHandler serves the audit trail.
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates a new AuditHandler.
+func NewAuditHandler(l *audit.Log) *AuditHandler {
+	return &AuditHandler{log: l}
+}
+
+// List handles GET /api/audit
+// Filters: action, actor, target, since, until (RFC 3339) and limit.
+// With format=jsonl the matching entries are streamed as JSON Lines.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Action: q.Get("action"),
+		Actor:  q.Get("actor"),
+		Target: q.Get("target"),
+	}
+	var err error
+	if f.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, "since: "+err.Error())
+		return
+	}
+	if f.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, "until: "+err.Error())
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+
+	if q.Get("format") == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		if err := h.log.Export(w, f); err != nil {
+			log.Printf("audit export failed: %v", err)
+		}
+		return
+	}
+
+	entries, err := h.log.Query(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "read audit log: "+err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"entries": entries, "total": len(entries)})
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// newAuditEntry starts an audit record for the caller of r.
+func newAuditEntry(r *http.Request, action, target string) audit.Entry {
+	e := audit.Entry{Action: action, Target: target, SourceIP: clientIP(r)}
+	if p := auth.FromContext(r.Context()); p != nil {
+		e.Actor = p.Name
+		e.TokenID = p.TokenID
+	}
+	return e
+}
+
+// recordAudit appends e, logging rather than failing the request if the
+// audit file cannot be written.
+func recordAudit(l *audit.Log, e audit.Entry) {
+	if err := l.Record(e); err != nil {
+		log.Printf("audit: record %s %s failed: %v", e.Action, e.Target, err)
+	}
+}
+
+// trustedProxies are the peers whose X-Forwarded-For header is believed,
+// normally just Caddy. Set once at startup by TrustProxies.
+var trustedProxies []*net.IPNet
+
+// TrustProxies parses a comma-separated list of IPs and CIDRs whose
+// X-Forwarded-For header clientIP may use.
+func TrustProxies(list string) error {
+	var nets []*net.IPNet
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return fmt.Errorf("invalid proxy address %q", v)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			v = fmt.Sprintf("%s/%d", v, bits)
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return fmt.Errorf("invalid proxy address %q", v)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only used when
+// the peer is a trusted proxy, and then only its last hop: that is the
+// address the proxy itself saw, while earlier hops are whatever the client
+// chose to send.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	xff := r.Header.Values("X-Forwarded-For")
+	if len(xff) == 0 || !isTrustedProxy(net.ParseIP(host)) {
+		return host
+	}
+	hops := strings.Split(xff[len(xff)-1], ",")
+	if last := strings.TrimSpace(hops[len(hops)-1]); net.ParseIP(last) != nil {
+		return last
+	}
+	return host
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditBatch records a multi-service operation such as a sync, whose
+// per-service failures are collected in errs.
+// Callers must hold h.mu.
+func (h *ServicesHandler) auditBatch(e audit.Entry, errs []string, details map[string]any) {
+	e.Version = h.snapshot(e)
+	e.Success = len(errs) == 0
+	e.Caddy = "ok"
+	if !e.Success {
+		e.Caddy = strings.Join(errs, "; ")
+		e.Error = fmt.Sprintf("%d of the caddy changes failed", len(errs))
+	}
+	e.Details = details
+	recordAudit(h.audit, e)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := TrustProxies("10.0.0.5, 172.18.0.0/16"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedProxies = nil })
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.9:5000", nil, "203.0.113.9"},
+		{"spoofed header from untrusted peer", "203.0.113.9:5000", []string{"1.2.3.4"}, "203.0.113.9"},
+		{"trusted proxy", "10.0.0.5:4000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"trusted proxy by cidr", "172.18.0.3:4000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"client-supplied hops ignored", "10.0.0.5:4000", []string{"1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"last header wins", "10.0.0.5:4000", []string{"1.2.3.4", "198.51.100.7"}, "198.51.100.7"},
+		{"garbage hop", "10.0.0.5:4000", []string{"not-an-ip"}, "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrustProxiesRejectsGarbage(t *testing.T) {
+	t.Cleanup(func() { trustedProxies = nil })
+	for _, v := range []string{"caddy", "10.0.0.0/33", "1.2.3"} {
+		if err := TrustProxies(v); err == nil {
+			t.Errorf("TrustProxies(%q) accepted", v)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"caddy-admin/certmon"
+	"net/http"
+)
+
+// CertMonitorHandler exposes the certificate expiry monitor.
+type CertMonitorHandler struct {
+	monitor *certmon.Monitor
+}
+
+// NewCertMonitorHandler creates a new CertMonitorHandler.
+func NewCertMonitorHandler(m *certmon.Monitor) *CertMonitorHandler {
+	return &CertMonitorHandler{monitor: m}
+}
+
+// Status handles GET /api/certs/alerts
+func (h *CertMonitorHandler) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.monitor.Status())
+}
+
+// Test handles POST /api/certs/alerts/test: one test alert through every
+// configured notifier, with each notifier's result.
+func (h *CertMonitorHandler) Test(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"results": h.monitor.SendTest(r.Context())})
+}
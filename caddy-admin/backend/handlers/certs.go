@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"caddy-admin/caddy"
+	"caddy-admin/store"
+	"fmt"
 	"net/http"
 	"os"
 )
@@ -9,6 +11,11 @@ import (
 type CertsHandler struct {
 	certStorePath   string
 	externalCertDir string
+
+	// Live TLS probing, enabled by UseProber.
+	prober       *caddy.Prober
+	caddyClient  *caddy.Client
+	serviceStore store.ServiceStore
 }
 
 func NewCertsHandler(certStorePath, externalCertDir string) *CertsHandler {
@@ -21,8 +28,70 @@ func NewCertsHandler(certStorePath, externalCertDir string) *CertsHandler {
 	}
 }
 
-// ListCerts handles GET /api/certs
+// UseProber enables ?probe=true on ListCerts: a TLS handshake for every
+// site and service hostname, found through client and ss.
+func (h *CertsHandler) UseProber(p *caddy.Prober, client *caddy.Client, ss store.ServiceStore) {
+	h.prober = p
+	h.caddyClient = client
+	h.serviceStore = ss
+}
+
+// ListCerts handles GET /api/certs[?probe=true]. With probe, "probes"
+// holds what Caddy actually presents for each hostname compared with the
+// certificates on disk.
 func (h *CertsHandler) ListCerts(w http.ResponseWriter, r *http.Request) {
+	certs := h.Certs()
+	resp := map[string]any{
+		"certs": certs,
+		"total": len(certs),
+	}
+	if r.URL.Query().Get("probe") == "true" {
+		if h.prober == nil {
+			writeError(w, http.StatusNotImplemented, "tls probing is not configured")
+			return
+		}
+		hosts, err := h.ProbeHosts()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		resp["probes"] = h.prober.ProbeAll(r.Context(), hosts, certs)
+	}
+	writeJSON(w, resp)
+}
+
+// ProbeHosts returns the hostnames that should be served over TLS.
+func (h *CertsHandler) ProbeHosts() ([]string, error) {
+	cfg, err := h.caddyClient.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach caddy: %w", err)
+	}
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load failed: %w", err)
+	}
+	return caddy.ProbeHosts(caddy.ParseSites(cfg), services), nil
+}
+
+// GetCert handles GET /api/certs/{fingerprint}. The SHA-256 fingerprint
+// may be given with or without ":" separators.
+func (h *CertsHandler) GetCert(w http.ResponseWriter, r *http.Request) {
+	fp := caddy.NormalizeFingerprint(r.PathValue("fingerprint"))
+	if fp == "" {
+		writeError(w, http.StatusBadRequest, "fingerprint required")
+		return
+	}
+	for _, c := range h.Certs() {
+		if c.Fingerprint == fp {
+			writeJSON(w, c)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "certificate not found: "+fp)
+}
+
+// Certs reads every certificate from both sources.
+func (h *CertsHandler) Certs() []caddy.CertInfo {
 	var certs []caddy.CertInfo
 
 	// 1. Caddy 内部自动管理的证书（/data/caddy/certificates/...）
@@ -34,9 +103,5 @@ func (h *CertsHandler) ListCerts(w http.ResponseWriter, r *http.Request) {
 	if h.externalCertDir != "" {
 		certs = append(certs, caddy.ReadExternalCerts(h.externalCertDir)...)
 	}
-
-	writeJSON(w, map[string]any{
-		"certs": certs,
-		"total": len(certs),
-	})
+	return certs
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/certwatch"
+	"net/http"
+)
+
+// CertReloadHandler exposes the external certificate watcher.
+type CertReloadHandler struct {
+	watcher *certwatch.Watcher
+}
+
+// NewCertReloadHandler creates a new CertReloadHandler. w is nil when
+// EXTERNAL_CERT_DIR is not set.
+func NewCertReloadHandler(w *certwatch.Watcher) *CertReloadHandler {
+	return &CertReloadHandler{watcher: w}
+}
+
+// Status handles GET /api/certs/reload
+func (h *CertReloadHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if h.watcher == nil {
+		writeJSON(w, map[string]any{"running": false})
+		return
+	}
+	writeJSON(w, h.watcher.Status())
+}
+
+// Reload handles POST /api/certs/reload: validate EXTERNAL_CERT_DIR now
+// and load it into Caddy, e.g. from an acme.sh --reloadcmd. Invalid files
+// answer 422 and a failed reload 502; the body is the outcome either way.
+func (h *CertReloadHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if h.watcher == nil {
+		writeError(w, http.StatusNotFound, "EXTERNAL_CERT_DIR is not set")
+		return
+	}
+	res := h.watcher.Apply(r.Context(), "manual", newAuditEntry(r, audit.ActionCertReload, ""))
+	w.Header().Set("Content-Type", "application/json")
+	switch res.Outcome {
+	case certwatch.OutcomeInvalid:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case certwatch.OutcomeReloadFailed:
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	writeJSON(w, res)
+}
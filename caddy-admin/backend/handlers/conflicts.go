@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"caddy-admin/auth"
+	"caddy-admin/caddy"
+	"fmt"
+	"net/http"
+)
+
+// checkConflicts rejects svc with 409 if its domain and path are already
+// served by another service or a Caddyfile site. With ?override=true the
+// registration goes ahead, provided the caller could manage every owner
+// it displaces: the other service's prefix, or admin for Caddyfile sites.
+// It returns the overridden conflicts and whether to continue.
+func (h *ServicesHandler) checkConflicts(w http.ResponseWriter, r *http.Request, svc caddy.ServiceConfig) ([]caddy.Conflict, bool) {
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return nil, false
+	}
+	cfg, err := h.caddyClient.GetConfig()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return nil, false
+	}
+
+	conflicts := caddy.FindConflicts(svc, caddy.ParseSites(cfg), services)
+	if len(conflicts) == 0 {
+		return nil, true
+	}
+
+	if r.URL.Query().Get("override") != "true" {
+		msg := conflicts[0].String()
+		if len(conflicts) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(conflicts)-1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		writeJSON(w, map[string]any{
+			"error":     msg + "; pass override=true to register anyway",
+			"conflicts": conflicts,
+		})
+		return nil, false
+	}
+
+	p := auth.FromContext(r.Context())
+	for _, c := range conflicts {
+		allowed := p.CanManage(c.Service)
+		if c.Owner == caddy.OwnerCaddyfile {
+			allowed = p != nil && p.Scope.Allows(auth.ScopeAdmin)
+		}
+		if !allowed {
+			writeError(w, http.StatusForbidden, "override not permitted: "+c.String())
+			return nil, false
+		}
+	}
+	return conflicts, true
+}
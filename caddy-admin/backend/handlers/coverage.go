@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"caddy-admin/caddy"
+	"caddy-admin/store"
+	"net/http"
+	"strconv"
+)
+
+// defaultExpiringDays is the expiring window of the coverage report.
+const defaultExpiringDays = 30
+
+// CoverageHandler reports which certificate serves each site and service.
+type CoverageHandler struct {
+	caddyClient  *caddy.Client
+	serviceStore store.ServiceStore
+	certs        func() []caddy.CertInfo
+}
+
+// NewCoverageHandler creates a new CoverageHandler reading certificates
+// from certs.
+func NewCoverageHandler(client *caddy.Client, ss store.ServiceStore, certs func() []caddy.CertInfo) *CoverageHandler {
+	return &CoverageHandler{caddyClient: client, serviceStore: ss, certs: certs}
+}
+
+// Coverage handles GET /api/certs/coverage[?days=30]
+func (h *CoverageHandler) Coverage(w http.ResponseWriter, r *http.Request) {
+	days := defaultExpiringDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "days must be a non-negative integer")
+			return
+		}
+		days = n
+	}
+
+	cfg, err := h.caddyClient.GetConfig()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return
+	}
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	writeJSON(w, caddy.BuildCoverage(caddy.ParseSites(cfg), services, h.certs(), days))
+}
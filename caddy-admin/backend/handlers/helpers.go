@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"caddy-admin/auth"
+	"caddy-admin/caddy"
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -15,3 +18,60 @@ func writeError(w http.ResponseWriter, code int, msg string) {
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
+
+// canManage reports whether the caller may change the named service and
+// writes a 403 if not.
+func canManage(w http.ResponseWriter, r *http.Request, name string) bool {
+	if auth.FromContext(r.Context()).CanManage(name) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "token may not manage service "+name)
+	return false
+}
+
+// canClaim reports whether the caller may give svc a wildcard domain or a
+// non-zero priority, and writes a 403 if not. Both let a route take
+// requests from other services, so only admin may introduce them;
+// existing is the stored service on update (nil on register), whose
+// values may be kept.
+func canClaim(w http.ResponseWriter, r *http.Request, svc caddy.ServiceConfig, existing *caddy.ServiceConfig) bool {
+	if p := auth.FromContext(r.Context()); p != nil && p.Scope.Allows(auth.ScopeAdmin) {
+		return true
+	}
+	kept := map[string]bool{}
+	if existing != nil {
+		for _, d := range existing.DomainList() {
+			kept[d] = true
+		}
+	}
+	for _, d := range svc.DomainList() {
+		if strings.Contains(d, "*") && !kept[d] {
+			writeError(w, http.StatusForbidden, "wildcard domain "+d+" requires admin scope")
+			return false
+		}
+	}
+	if svc.Priority != 0 && (existing == nil || svc.Priority != existing.Priority) {
+		writeError(w, http.StatusForbidden, "non-zero priority requires admin scope")
+		return false
+	}
+	return true
+}
+
+// serviceName returns the {name} path value and writes a 400 if it is not
+// a valid service name. Names stored before names were restricted are
+// accepted as long as Caddy can address them, so those services can still
+// be updated, heartbeated and removed.
+func (h *ServicesHandler) serviceName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	err := caddy.ValidateName(name)
+	if err != nil && caddy.ValidateLegacyName(name) == nil {
+		if _, stored, _ := h.serviceStore.Get(name); stored {
+			err = nil
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"caddy-admin/auth"
+	"caddy-admin/caddy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanClaim(t *testing.T) {
+	register := &auth.Principal{Name: "ci", Scope: auth.ScopeRegister, Prefix: "team-"}
+	admin := &auth.Principal{Name: "root", Scope: auth.ScopeAdmin}
+	stored := caddy.ServiceConfig{Name: "team-a", Domain: "*.a.test", Priority: 3}
+
+	tests := []struct {
+		name     string
+		p        *auth.Principal
+		svc      caddy.ServiceConfig
+		existing *caddy.ServiceConfig
+		want     bool
+	}{
+		{"plain register", register, caddy.ServiceConfig{Domain: "a.test"}, nil, true},
+		{"wildcard register", register, caddy.ServiceConfig{Domain: "*.a.test"}, nil, false},
+		{"wildcard alias", register, caddy.ServiceConfig{Domain: "a.test", Domains: []string{"a.test", "*.b.test"}}, nil, false},
+		{"priority register", register, caddy.ServiceConfig{Domain: "a.test", Priority: 1}, nil, false},
+		{"admin", admin, caddy.ServiceConfig{Domain: "*.a.test", Priority: 9}, nil, true},
+		{"update keeps admin's values", register, caddy.ServiceConfig{Domain: "*.a.test", Priority: 3, Upstream: "new:80"}, &stored, true},
+		{"update changes priority", register, caddy.ServiceConfig{Domain: "*.a.test", Priority: 4}, &stored, false},
+		{"update resets priority", register, caddy.ServiceConfig{Domain: "*.a.test"}, &stored, true},
+		{"update adds wildcard", register, caddy.ServiceConfig{Domain: "*.a.test", Domains: []string{"*.a.test", "*.c.test"}, Priority: 3}, &stored, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/services", nil)
+		r = r.WithContext(auth.WithPrincipal(r.Context(), tt.p))
+		w := httptest.NewRecorder()
+		if got := canClaim(w, r, tt.svc, tt.existing); got != tt.want {
+			t.Errorf("%s: canClaim = %v, want %v", tt.name, got, tt.want)
+		}
+		if !tt.want && w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", tt.name, w.Code)
+		}
+	}
+}
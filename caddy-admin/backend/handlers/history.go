@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/caddy"
+	"caddy-admin/history"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HistoryHandler serves the config history.
+type HistoryHandler struct {
+	history *history.Store
+}
+
+// NewHistoryHandler creates a new HistoryHandler.
+func NewHistoryHandler(hist *history.Store) *HistoryHandler {
+	return &HistoryHandler{history: hist}
+}
+
+// List handles GET /api/history
+func (h *HistoryHandler) List(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.history.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "read history: "+err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"versions": versions, "total": len(versions)})
+}
+
+// Get handles GET /api/history/{version}
+func (h *HistoryHandler) Get(w http.ResponseWriter, r *http.Request) {
+	snap, ok := loadSnapshot(w, h.history, r.PathValue("version"))
+	if !ok {
+		return
+	}
+	writeJSON(w, snap)
+}
+
+// Diff handles GET /api/history/diff?from=N[&to=M]
+// to defaults to the latest version.
+func (h *HistoryHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := q.Get("to")
+	if to == "" {
+		to = strconv.Itoa(h.history.Latest().Version)
+	}
+	from, ok := loadSnapshot(w, h.history, q.Get("from"))
+	if !ok {
+		return
+	}
+	target, ok := loadSnapshot(w, h.history, to)
+	if !ok {
+		return
+	}
+	diff, err := history.Compare(from, target)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "diff failed: "+err.Error())
+		return
+	}
+	writeJSON(w, diff)
+}
+
+// loadSnapshot fetches a snapshot by its version string, writing an
+// error if it cannot.
+func loadSnapshot(w http.ResponseWriter, hist *history.Store, v string) (*history.Snapshot, bool) {
+	version, err := strconv.Atoi(v)
+	if err != nil || version <= 0 {
+		writeError(w, http.StatusBadRequest, "version must be a positive integer")
+		return nil, false
+	}
+	snap, err := hist.Get(version)
+	if errors.Is(err, history.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "history version not found: "+v)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "read history: "+err.Error())
+		return nil, false
+	}
+	return snap, true
+}
+
+// Rollback handles POST /api/history/{version}/rollback
+// It loads the snapshot's full config into Caddy and makes the service
+// registry match the snapshot. If the registry cannot be rewritten,
+// Caddy's previous config is loaded back.
+func (h *ServicesHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	v := r.PathValue("version")
+	snap, ok := loadSnapshot(w, h.history, v)
+	if !ok {
+		return
+	}
+	version := snap.Version.Version
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := newAuditEntry(r, audit.ActionRollback, v)
+	e.Details = map[string]any{"from": h.history.Latest().Version, "to": version}
+	if op := h.rollbackTo(snap); op != nil {
+		e.Error = op.Error
+		e.Caddy = op.caddy
+		if op.caddy != "" {
+			e.Version = h.snapshot(e)
+		}
+		recordAudit(h.audit, e)
+		writeOpError(w, op)
+		return
+	}
+
+	e.Success = true
+	e.Caddy = "ok"
+	e.Version = h.snapshot(e)
+	recordAudit(h.audit, e)
+	writeJSON(w, map[string]any{
+		"restored": version,
+		"version":  e.Version,
+		"services": len(snap.Services),
+	})
+}
+
+// rollbackTo applies snap to Caddy and the store. Callers hold h.mu.
+func (h *ServicesHandler) rollbackTo(snap *history.Snapshot) *opError {
+	current, err := h.serviceStore.Load()
+	if err != nil {
+		return &opError{Code: http.StatusInternalServerError, Error: "load failed: " + err.Error()}
+	}
+	currentConfig, err := h.caddyClient.GetConfigRaw()
+	if err != nil {
+		return &opError{Code: http.StatusServiceUnavailable, Error: "cannot reach caddy: " + err.Error()}
+	}
+
+	if err := h.caddyClient.LoadConfig(snap.Config); err != nil {
+		return &opError{Code: http.StatusBadGateway, Error: "caddy load failed: " + err.Error(), caddy: err.Error()}
+	}
+
+	// Restored leases start fresh; their old expiry is long past.
+	now := time.Now()
+	target := make([]caddy.ServiceConfig, len(snap.Services))
+	for i, svc := range snap.Services {
+		svc.RenewLease(now)
+		target[i] = svc
+	}
+	if err := h.replaceServices(current, target); err != nil {
+		// Put back both halves; the store may be partly rewritten.
+		undoErr := h.caddyClient.LoadConfig(currentConfig)
+		if restoreErr := h.replaceServices(target, current); undoErr == nil {
+			undoErr = restoreErr
+		}
+		return rollbackResult("persist failed: "+err.Error(), "history rollback", undoErr)
+	}
+	return nil
+}
+
+// replaceServices rewrites the store from the from registry to the to
+// registry, one service at a time.
+func (h *ServicesHandler) replaceServices(from, to []caddy.ServiceConfig) error {
+	keep := make(map[string]bool, len(to))
+	for _, svc := range to {
+		keep[svc.Name] = true
+	}
+	for _, svc := range from {
+		if keep[svc.Name] {
+			continue
+		}
+		if err := h.serviceStore.Delete(svc.Name); err != nil {
+			return err
+		}
+	}
+	for _, svc := range to {
+		if err := h.serviceStore.Upsert(svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot records the current Caddy config and registry in the history
+// and returns the resulting version (0 if it could not be recorded).
+// Callers hold h.mu so the two halves match.
+func (h *ServicesHandler) snapshot(e audit.Entry) int {
+	if h.history == nil {
+		return 0
+	}
+	raw, err := h.caddyClient.GetConfigRaw()
+	if err != nil {
+		log.Printf("history: snapshot after %s failed: %v", e.Action, err)
+		return 0
+	}
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		log.Printf("history: snapshot after %s failed: %v", e.Action, err)
+		return 0
+	}
+	v, err := h.history.Record(e.Actor, history.Reason(e.Action, e.Target), raw, services)
+	if err != nil {
+		log.Printf("history: snapshot after %s failed: %v", e.Action, err)
+		return 0
+	}
+	return v.Version
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Heartbeat handles POST /api/services/{name}/heartbeat
+// It extends the lease of a service registered with a ttl. The route in
+// Caddy is untouched; only ExpiresAt moves forward.
+func (h *ServicesHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.serviceName(w, r)
+	if !ok {
+		return
+	}
+	if !canManage(w, r, name) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	svc, ok, err := h.serviceStore.Get(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	if !ok {
+		// Expired and reaped (or never registered): the caller should re-register
+		writeError(w, http.StatusNotFound, "service not found: "+name)
+		return
+	}
+	if svc.TTL == "" {
+		writeError(w, http.StatusConflict, "service has no ttl; register it with a ttl to use heartbeats")
+		return
+	}
+
+	svc.RenewLease(time.Now())
+	if err := h.serviceStore.Upsert(svc); err != nil {
+		writeError(w, http.StatusInternalServerError, "persist failed: "+err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"name": svc.Name, "ttl": svc.TTL, "expiresAt": svc.ExpiresAt})
+}
+
+// RunReaper deregisters services whose lease expired, checking every
+// interval until ctx is cancelled.
+func (h *ServicesHandler) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.reapExpired(time.Now())
+		}
+	}
+}
+
+// reapExpired removes every service whose lease ran out before now and
+// returns their names.
+func (h *ServicesHandler) reapExpired(now time.Time) []string {
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		log.Printf("reaper: load services failed: %v", err)
+		return nil
+	}
+
+	var reaped []string
+	for _, svc := range services {
+		if !svc.Expired(now) {
+			continue
+		}
+		if h.reapOne(svc.Name, now) {
+			reaped = append(reaped, svc.Name)
+		}
+	}
+	if len(reaped) > 0 {
+		log.Printf("reaper: deregistered expired services: %v", reaped)
+	}
+	return reaped
+}
+
+// reapOne re-checks the lease under the lock, so a heartbeat that landed
+// after Load still saves the service.
+func (h *ServicesHandler) reapOne(name string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	svc, ok, err := h.serviceStore.Get(name)
+	if err != nil || !ok || !svc.Expired(now) {
+		return false
+	}
+	if e := h.removeServiceLocked(audit.Entry{Actor: "reaper", Action: audit.ActionExpire, Target: name}, name); e != nil {
+		log.Printf("reaper: deregister %s failed: %s", name, e.Error)
+		return false
+	}
+	return true
+}
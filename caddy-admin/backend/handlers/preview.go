@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"caddy-admin/caddy"
+	"net/http"
+)
+
+// isDryRun reports whether the caller asked for a preview with
+// ?dry_run=true instead of the change itself.
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
+
+// previewService answers a dry run of registering or updating svc: the
+// route JSON it would get, the diff against the live config and the
+// stored config it would replace. Neither Caddy nor the store is changed.
+func (h *ServicesHandler) previewService(w http.ResponseWriter, svc caddy.ServiceConfig) {
+	resp, ok := h.previewUpsert(w, svc)
+	if !ok {
+		return
+	}
+	before, err := h.storedService(svc.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	resp["before"] = before
+	resp["after"] = svc
+	writeJSON(w, resp)
+}
+
+// previewSync answers a dry run of re-applying every stored service.
+func (h *ServicesHandler) previewSync(w http.ResponseWriter, services []caddy.ServiceConfig) {
+	if resp, ok := h.previewUpsert(w, services...); ok {
+		resp["total"] = len(services)
+		writeJSON(w, resp)
+	}
+}
+
+// previewUpsert builds the dry-run response for routing services, or
+// writes an error and returns false.
+func (h *ServicesHandler) previewUpsert(w http.ResponseWriter, services ...caddy.ServiceConfig) (map[string]any, bool) {
+	raw, err := h.caddyClient.GetConfigRaw()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return nil, false
+	}
+	p, err := h.caddyClient.PreviewUpsert(raw, services...)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "preview failed: "+err.Error())
+		return nil, false
+	}
+	return map[string]any{"dryRun": true, "routes": p.Routes, "changes": p.Changes}, true
+}
+
+// previewRemove answers a dry run of deregistering name.
+func (h *ServicesHandler) previewRemove(w http.ResponseWriter, name string) {
+	raw, err := h.caddyClient.GetConfigRaw()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return
+	}
+	p, err := h.caddyClient.PreviewRemove(raw, name)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "preview failed: "+err.Error())
+		return
+	}
+	before, err := h.storedService(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"dryRun": true, "changes": p.Changes, "before": before})
+}
+
+// storedService returns the stored config for name, or nil if there is
+// none.
+func (h *ServicesHandler) storedService(name string) (*caddy.ServiceConfig, error) {
+	svc, ok, err := h.serviceStore.Get(name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &svc, nil
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"caddy-admin/reconcile"
+	"net/http"
+)
+
+// ReconcileHandler exposes the background reconciler's state.
+type ReconcileHandler struct {
+	reconciler *reconcile.Reconciler
+}
+
+// NewReconcileHandler creates a new ReconcileHandler.
+func NewReconcileHandler(r *reconcile.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{reconciler: r}
+}
+
+// Status handles GET /api/reconciler
+func (h *ReconcileHandler) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.reconciler.Status())
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/caddy"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// opError is a failed service mutation with the HTTP status to report.
+type opError struct {
+	Code  int    `json:"-"`
+	Error string `json:"error"`
+	// RolledBack reports that a compensating action undid the Caddy change.
+	RolledBack bool `json:"rolledBack"`
+	// RollbackError is set when the compensating action also failed and
+	// Caddy and the store are out of sync until the next sync.
+	RollbackError string `json:"rollbackError,omitempty"`
+	// caddy is the Caddy outcome for the audit log: "ok", its error, or
+	// empty when Caddy was never called.
+	caddy string
+}
+
+func writeOpError(w http.ResponseWriter, e *opError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	writeJSON(w, e)
+}
+
+// applyService routes svc in Caddy and persists it as one unit. Caddy is
+// changed first; if persisting fails, the previous route (or no route, for
+// a new service) is put back so Caddy never holds a route the store lost.
+// The outcome is recorded in the history and the audit entry e. Callers
+// hold h.mu across their conflict check and this call, so no other
+// service can claim the same domain in between.
+func (h *ServicesHandler) applyServiceLocked(e audit.Entry, svc caddy.ServiceConfig) *opError {
+	before, op := h.upsertService(svc)
+	h.finishOp(e, before, &svc, op)
+	return op
+}
+
+// upsertService does the work of applyServiceLocked and returns the config
+// that was stored before, or nil for a new service.
+func (h *ServicesHandler) upsertService(svc caddy.ServiceConfig) (*caddy.ServiceConfig, *opError) {
+	prev, existed, err := h.serviceStore.Get(svc.Name)
+	if err != nil {
+		return nil, &opError{Code: http.StatusInternalServerError, Error: "load failed: " + err.Error()}
+	}
+	var before *caddy.ServiceConfig
+	if existed {
+		before = &prev
+	}
+
+	if err := h.caddyClient.UpsertRoute(svc); err != nil {
+		return before, &opError{Code: http.StatusBadGateway, Error: "caddy upsert failed: " + err.Error(), caddy: err.Error()}
+	}
+
+	if err := h.serviceStore.Upsert(svc); err != nil {
+		var undoErr error
+		if existed {
+			undoErr = h.caddyClient.UpsertRoute(prev)
+		} else {
+			undoErr = h.caddyClient.RemoveRoute(svc.Name)
+		}
+		return before, rollbackResult("persist failed: "+err.Error(), svc.Name, undoErr)
+	}
+	return before, nil
+}
+
+// removeService deletes the route from Caddy and the store as one unit.
+// If the store write fails, the route is restored from the stored config.
+// The outcome is recorded in the history and the audit entry e.
+func (h *ServicesHandler) removeService(e audit.Entry, name string) *opError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.removeServiceLocked(e, name)
+}
+
+// removeServiceLocked is removeService for callers already holding h.mu.
+func (h *ServicesHandler) removeServiceLocked(e audit.Entry, name string) *opError {
+	before, op := h.deleteService(name)
+	h.finishOp(e, before, nil, op)
+	return op
+}
+
+// deleteService does the work of removeService and returns the config
+// that was stored, or nil if there was none.
+func (h *ServicesHandler) deleteService(name string) (*caddy.ServiceConfig, *opError) {
+	prev, existed, err := h.serviceStore.Get(name)
+	if err != nil {
+		return nil, &opError{Code: http.StatusInternalServerError, Error: "load failed: " + err.Error()}
+	}
+	var before *caddy.ServiceConfig
+	if existed {
+		before = &prev
+	}
+
+	if err := h.caddyClient.RemoveRoute(name); err != nil {
+		return before, &opError{Code: http.StatusBadGateway, Error: "caddy remove failed: " + err.Error(), caddy: err.Error()}
+	}
+
+	if err := h.serviceStore.Delete(name); err != nil {
+		var undoErr error
+		if existed {
+			undoErr = h.caddyClient.UpsertRoute(prev)
+		}
+		return before, rollbackResult("persist failed: "+err.Error(), name, undoErr)
+	}
+	return before, nil
+}
+
+// finishOp snapshots the new state if Caddy was touched and records the
+// audit entry.
+func (h *ServicesHandler) finishOp(e audit.Entry, before, after *caddy.ServiceConfig, op *opError) {
+	e.Before = before
+	e.After = after
+	e.Success = op == nil
+	e.Caddy = "ok"
+	if op != nil {
+		e.Error = op.Error
+		if op.RollbackError != "" {
+			e.Error += "; rollback failed: " + op.RollbackError
+		}
+		e.Caddy = op.caddy
+	}
+	if e.Caddy != "" {
+		e.Version = h.snapshot(e)
+	}
+	recordAudit(h.audit, e)
+}
+
+func rollbackResult(msg, name string, undoErr error) *opError {
+	e := &opError{Code: http.StatusInternalServerError, Error: msg, RolledBack: undoErr == nil, caddy: "ok"}
+	if undoErr != nil {
+		e.RollbackError = undoErr.Error()
+		log.Printf("rollback of %s failed, caddy and store out of sync: %v", name, undoErr)
+	} else {
+		e.Error = fmt.Sprintf("%s (caddy change rolled back)", msg)
+	}
+	return e
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/auth"
+	"caddy-admin/caddy"
+	"caddy-admin/caddy/caddytest"
+	"caddy-admin/history"
+	"caddy-admin/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// flakyStore is a FileStore whose writes can be made to fail.
+type flakyStore struct {
+	*store.FileStore
+	failUpsert, failDelete bool
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (s *flakyStore) Upsert(svc caddy.ServiceConfig) error {
+	if s.failUpsert {
+		return errDiskFull
+	}
+	return s.FileStore.Upsert(svc)
+}
+
+func (s *flakyStore) Delete(name string) error {
+	if s.failDelete {
+		return errDiskFull
+	}
+	return s.FileStore.Delete(name)
+}
+
+type opsFixture struct {
+	t       *testing.T
+	caddy   *caddytest.Server
+	store   *flakyStore
+	audit   *audit.Log
+	history *history.Store
+	h       *ServicesHandler
+}
+
+func newOpsFixture(t *testing.T) *opsFixture {
+	dir := t.TempDir()
+	f := &opsFixture{t: t, caddy: caddytest.NewServer(t, "")}
+	f.store = &flakyStore{FileStore: store.NewFileStore(filepath.Join(dir, "services.json"))}
+	var err error
+	if f.audit, err = audit.Open(filepath.Join(dir, "audit.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	if f.history, err = history.Open(filepath.Join(dir, "history"), 50); err != nil {
+		t.Fatal(err)
+	}
+	client := caddy.NewClient(f.caddy.Addr())
+	client.UseRegistry(f.store.Load)
+	f.h = NewServicesHandler(client, f.store, f.audit, f.history)
+	return f
+}
+
+// do calls handler as an admin and returns the response status.
+func (f *opsFixture) do(handler http.HandlerFunc, method, name, body string) int {
+	r := httptest.NewRequest(method, "/api/services/"+name, strings.NewReader(body))
+	r.SetPathValue("name", name)
+	r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Name: "test", Scope: auth.ScopeAdmin}))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code
+}
+
+// state is everything a failed operation must leave untouched.
+type opsState struct {
+	caddy    string
+	services []caddy.ServiceConfig
+	applied  int // successful audit entries
+	versions []history.Version
+}
+
+func (f *opsFixture) state() opsState {
+	f.t.Helper()
+	services, err := f.store.Load()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	entries, err := f.audit.Query(audit.Filter{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	applied := 0
+	for _, e := range entries {
+		if e.Success {
+			applied++
+		}
+	}
+	versions, err := f.history.List()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return opsState{caddy: f.caddy.Config(), services: services, applied: applied, versions: versions}
+}
+
+// lastAudit returns the newest audit entry.
+func (f *opsFixture) lastAudit() audit.Entry {
+	f.t.Helper()
+	entries, err := f.audit.Query(audit.Filter{Limit: 1})
+	if err != nil || len(entries) != 1 {
+		f.t.Fatalf("audit query: %v (%d entries)", err, len(entries))
+	}
+	return entries[0]
+}
+
+func (f *opsFixture) assertUnchanged(before opsState) {
+	f.t.Helper()
+	after := f.state()
+	if after.caddy != before.caddy {
+		f.t.Errorf("caddy config changed:\nbefore %s\nafter  %s", before.caddy, after.caddy)
+	}
+	if !reflect.DeepEqual(after.services, before.services) {
+		f.t.Errorf("store changed: before %+v, after %+v", before.services, after.services)
+	}
+	if after.applied != before.applied {
+		f.t.Errorf("audit log records %d applied changes, want %d", after.applied, before.applied)
+	}
+	if !reflect.DeepEqual(after.versions, before.versions) {
+		f.t.Errorf("history changed: before %+v, after %+v", before.versions, after.versions)
+	}
+	if e := f.lastAudit(); e.Success || e.Error == "" {
+		f.t.Errorf("failure not recorded in audit log: %+v", e)
+	}
+}
+
+func bind(h *ServicesHandler, fn func(*ServicesHandler, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { fn(h, w, r) }
+}
+
+const (
+	apiBody = `{"name":"api","domain":"api.test","upstream":"api:8080"}`
+	webBody = `{"name":"web","domain":"web.test","upstream":"web:8080"}`
+)
+
+func TestServiceOpsCaddyFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string // Caddy request that fails
+		prefix  string
+		handler func(*ServicesHandler, http.ResponseWriter, *http.Request)
+		verb    string
+		service string
+		body    string
+	}{
+		{"register", http.MethodPost, "/config/", (*ServicesHandler).Register, http.MethodPost, "", webBody},
+		{"update", http.MethodPatch, "/id/", (*ServicesHandler).Update, http.MethodPatch, "api", `{"upstream":"api:9090"}`},
+		{"deregister", http.MethodDelete, "/id/", (*ServicesHandler).Deregister, http.MethodDelete, "api", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOpsFixture(t)
+			if code := f.do(f.h.Register, http.MethodPost, "", apiBody); code != http.StatusCreated {
+				t.Fatalf("setup register: %d", code)
+			}
+			before := f.state()
+
+			f.caddy.FailOn(tt.method, tt.prefix)
+			if code := f.do(bind(f.h, tt.handler), tt.verb, tt.service, tt.body); code != http.StatusBadGateway {
+				t.Errorf("status = %d, want %d", code, http.StatusBadGateway)
+			}
+			if f.caddy.Count(tt.method) == 0 {
+				t.Fatalf("no %s reached caddy", tt.method)
+			}
+			f.caddy.Recover()
+			f.assertUnchanged(before)
+		})
+	}
+}
+
+func TestServiceOpsStoreFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    func(*flakyStore)
+		handler func(*ServicesHandler, http.ResponseWriter, *http.Request)
+		verb    string
+		service string
+		body    string
+	}{
+		{"register", func(s *flakyStore) { s.failUpsert = true }, (*ServicesHandler).Register, http.MethodPost, "", webBody},
+		{"update", func(s *flakyStore) { s.failUpsert = true }, (*ServicesHandler).Update, http.MethodPatch, "api", `{"upstream":"api:9090"}`},
+		{"update moving route", func(s *flakyStore) { s.failUpsert = true }, (*ServicesHandler).Update, http.MethodPatch, "zeta", `{"priority":5}`},
+		{"deregister", func(s *flakyStore) { s.failDelete = true }, (*ServicesHandler).Deregister, http.MethodDelete, "api", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOpsFixture(t)
+			for _, body := range []string{apiBody, `{"name":"zeta","domain":"zeta.test","upstream":"zeta:8080"}`} {
+				if code := f.do(f.h.Register, http.MethodPost, "", body); code != http.StatusCreated {
+					t.Fatalf("setup register: %d", code)
+				}
+			}
+			before := f.state()
+
+			tt.fail(f.store)
+			if code := f.do(bind(f.h, tt.handler), tt.verb, tt.service, tt.body); code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", code, http.StatusInternalServerError)
+			}
+			// The Caddy change was undone: the previous route is back.
+			f.assertUnchanged(before)
+			if e := f.lastAudit(); !strings.Contains(e.Error, "rolled back") {
+				t.Errorf("audit error = %q, want rollback noted", e.Error)
+			}
+		})
+	}
+}
+
+func TestLegacyNameStillManageable(t *testing.T) {
+	f := newOpsFixture(t)
+	legacy := caddy.ServiceConfig{Name: "Old_API.v1", Domain: "old.test", Upstream: "old:8080", TTL: "1h"}
+	if err := f.h.caddyClient.AddRoute(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Upsert(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		handler http.HandlerFunc
+		verb    string
+		service string
+		body    string
+		want    int
+	}{
+		{"register new legacy name", f.h.Register, http.MethodPost, "", `{"name":"New_API","domain":"new.test","upstream":"new:8080"}`, http.StatusBadRequest},
+		{"update unknown legacy name", f.h.Update, http.MethodPatch, "New_API", `{"upstream":"new:9090"}`, http.StatusBadRequest},
+		{"update", f.h.Update, http.MethodPatch, legacy.Name, `{"upstream":"old:9090"}`, http.StatusOK},
+		{"heartbeat", f.h.Heartbeat, http.MethodPost, legacy.Name, "", http.StatusOK},
+		{"deregister", f.h.Deregister, http.MethodDelete, legacy.Name, "", http.StatusOK},
+		{"deregister again", f.h.Deregister, http.MethodDelete, legacy.Name, "", http.StatusBadRequest},
+	}
+	for _, s := range steps {
+		if code := f.do(s.handler, s.verb, s.service, s.body); code != s.want {
+			t.Fatalf("%s: status = %d, want %d", s.name, code, s.want)
+		}
+	}
+	if ids := f.caddy.RouteIDs("srv0"); len(ids) != 1 {
+		t.Errorf("routes = %v, want only the default route left", ids)
+	}
+}
+
+func TestConcurrentRegisterSameDomain(t *testing.T) {
+	f := newOpsFixture(t)
+	const n = 8
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"svc-%d","domain":"shared.test","upstream":"svc-%d:80"}`, i, i)
+			codes <- f.do(f.h.Register, http.MethodPost, "", body)
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("status %d", code)
+		}
+	}
+	services, _ := f.store.Load()
+	if created != 1 || len(services) != 1 {
+		t.Errorf("%d registrations succeeded, %d stored; want exactly one", created, len(services))
+	}
+}
@@ -1,70 +1,232 @@
 package handlers
 
 import (
+	"caddy-admin/audit"
 	"caddy-admin/caddy"
+	"caddy-admin/history"
 	"caddy-admin/store"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // ServicesHandler handles dynamic service registration API.
 type ServicesHandler struct {
-	caddyClient *caddy.Client
-	fileStore   *store.FileStore
+	caddyClient  *caddy.Client
+	serviceStore store.ServiceStore
+	audit        *audit.Log
+	history      *history.Store
+	mu           sync.Mutex // serializes mutations across Caddy and the store
 }
 
-// NewServicesHandler creates a new ServicesHandler.
-func NewServicesHandler(client *caddy.Client, fs *store.FileStore) *ServicesHandler {
-	return &ServicesHandler{caddyClient: client, fileStore: fs}
+// NewServicesHandler creates a new ServicesHandler. auditLog and hist may
+// be nil.
+func NewServicesHandler(client *caddy.Client, ss store.ServiceStore, auditLog *audit.Log, hist *history.Store) *ServicesHandler {
+	return &ServicesHandler{caddyClient: client, serviceStore: ss, audit: auditLog, history: hist}
 }
 
-// Register handles POST /api/services
+// Locker returns the lock that serializes service mutations, so other
+// writers to Caddy (the reconciler) can take part in it.
+func (h *ServicesHandler) Locker() sync.Locker {
+	return &h.mu
+}
+
+// Register handles POST /api/services[?dry_run=true][&override=true]
+// With dry_run=true nothing is changed; the response previews the route
+// and the config diff instead. A domain and path already served by another
+// service or a Caddyfile site is rejected with 409 unless override=true.
 func (h *ServicesHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var svc caddy.ServiceConfig
 	if err := json.NewDecoder(r.Body).Decode(&svc); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
 		return
 	}
-	if svc.Name == "" || svc.Domain == "" || svc.Upstream == "" {
-		writeError(w, http.StatusBadRequest, "name, domain, and upstream are required")
+	svc.Normalize()
+	if err := svc.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	if err := h.caddyClient.UpsertRoute(svc); err != nil {
-		writeError(w, http.StatusBadGateway, "caddy upsert failed: "+err.Error())
+	if !canManage(w, r, svc.Name) || !canClaim(w, r, svc, nil) {
+		return
+	}
+	svc.RenewLease(time.Now())
+	if isDryRun(r) {
+		if _, ok := h.checkConflicts(w, r, svc); ok {
+			h.previewService(w, svc)
+		}
 		return
 	}
 
-	if err := h.fileStore.Upsert(svc); err != nil {
-		writeError(w, http.StatusInternalServerError, "persist failed: "+err.Error())
+	// Check and apply under one lock, so two registrations for the same
+	// domain cannot both pass the check.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	overridden, ok := h.checkConflicts(w, r, svc)
+	if !ok {
+		return
+	}
+	entry := newAuditEntry(r, audit.ActionRegister, svc.Name)
+	if len(overridden) > 0 {
+		entry.Details = map[string]any{"overridden": overridden}
+	}
+	if e := h.applyServiceLocked(entry, svc); e != nil {
+		writeOpError(w, e)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	writeJSON(w, map[string]any{
-		"registered": true,
-		"name":       svc.Name,
-		"domain":     svc.Domain,
-		"upstream":   svc.Upstream,
-	})
+	writeJSON(w, serviceResponse("registered", svc))
 }
 
-// Deregister handles DELETE /api/services/{name}
-func (h *ServicesHandler) Deregister(w http.ResponseWriter, r *http.Request) {
-	name := r.PathValue("name")
-	if name == "" {
-		writeError(w, http.StatusBadRequest, "name required")
+// Update handles PUT /api/services/{name} (full replacement) and
+// PATCH /api/services/{name} (only the fields present in the body change).
+// The Caddy route is swapped in place, so the old route keeps serving
+// until the new one is live, and stays if the swap fails. dry_run=true
+// previews the change as for Register.
+func (h *ServicesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.serviceName(w, r)
+	if !ok {
+		return
+	}
+	if !canManage(w, r, name) {
 		return
 	}
 
-	if err := h.caddyClient.RemoveRoute(name); err != nil {
-		writeError(w, http.StatusBadGateway, "caddy remove failed: "+err.Error())
+	existing, ok, err := h.serviceStore.Get(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "service not found: "+name)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+
+	var svc caddy.ServiceConfig
+	if r.Method == http.MethodPatch {
+		svc, err = mergeServicePatch(existing, body)
+	} else {
+		err = json.Unmarshal(body, &svc)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
+		return
+	}
+	if svc.Name != "" && svc.Name != name {
+		writeError(w, http.StatusBadRequest, "name in body does not match path; renaming is not supported")
+		return
+	}
+	svc.Name = name
+
+	svc.Normalize()
+	validate := svc.Validate
+	if caddy.ValidateName(name) != nil {
+		validate = svc.ValidateLegacy // stored before names were restricted
+	}
+	if err := validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !canClaim(w, r, svc, &existing) {
+		return
+	}
+	svc.RenewLease(time.Now())
+	if isDryRun(r) {
+		if _, ok := h.checkConflicts(w, r, svc); ok {
+			h.previewService(w, svc)
+		}
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	overridden, ok := h.checkConflicts(w, r, svc)
+	if !ok {
+		return
+	}
+	entry := newAuditEntry(r, audit.ActionUpdate, name)
+	if len(overridden) > 0 {
+		entry.Details = map[string]any{"overridden": overridden}
+	}
+	if e := h.applyServiceLocked(entry, svc); e != nil {
+		writeOpError(w, e)
+		return
+	}
+
+	writeJSON(w, serviceResponse("updated", svc))
+}
+
+// mergeServicePatch overlays the JSON fields present in body onto existing.
+// Setting either upstream or upstreams replaces the whole upstream list,
+// and likewise domain or domains the whole domain list.
+func mergeServicePatch(existing caddy.ServiceConfig, body []byte) (caddy.ServiceConfig, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return existing, err
+	}
+	svc := existing
+	_, hasUpstream := fields["upstream"]
+	_, hasUpstreams := fields["upstreams"]
+	if hasUpstream || hasUpstreams {
+		svc.Upstream = ""
+		svc.Upstreams = nil
+	}
+	_, hasDomain := fields["domain"]
+	_, hasDomains := fields["domains"]
+	if hasDomain || hasDomains {
+		svc.Domain = ""
+		svc.Domains = nil
+	}
+	if svc.HealthCheck != nil {
+		hc := *svc.HealthCheck
+		svc.HealthCheck = &hc
+	}
+	if err := json.Unmarshal(body, &svc); err != nil {
+		return existing, err
+	}
+	return svc, nil
+}
+
+func serviceResponse(action string, svc caddy.ServiceConfig) map[string]any {
+	return map[string]any{
+		action:      true,
+		"name":      svc.Name,
+		"domain":    svc.Domain,
+		"domains":   svc.DomainList(),
+		"upstream":  svc.Upstream,
+		"upstreams": svc.UpstreamList(),
+		"lbPolicy":  svc.LBPolicy,
+		"path":      svc.Path,
+		"ttl":       svc.TTL,
+		"expiresAt": svc.ExpiresAt,
+	}
+}
+
+// Deregister handles DELETE /api/services/{name}[?dry_run=true]
+func (h *ServicesHandler) Deregister(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.serviceName(w, r)
+	if !ok {
+		return
+	}
+	if !canManage(w, r, name) {
+		return
+	}
+	if isDryRun(r) {
+		h.previewRemove(w, name)
 		return
 	}
 
-	if err := h.fileStore.Delete(name); err != nil {
-		writeError(w, http.StatusInternalServerError, "persist failed: "+err.Error())
+	if e := h.removeService(newAuditEntry(r, audit.ActionDeregister, name), name); e != nil {
+		writeOpError(w, e)
 		return
 	}
 
@@ -73,7 +235,7 @@ func (h *ServicesHandler) Deregister(w http.ResponseWriter, r *http.Request) {
 
 // List handles GET /api/services
 func (h *ServicesHandler) List(w http.ResponseWriter, r *http.Request) {
-	services, err := h.fileStore.Load()
+	services, err := h.serviceStore.Load()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
 		return
@@ -81,13 +243,20 @@ func (h *ServicesHandler) List(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]any{"services": services, "total": len(services)})
 }
 
-// Sync handles POST /api/services/sync — manually trigger syncToCaddy
+// Sync handles POST /api/services/sync[?dry_run=true] — manually trigger syncToCaddy
 func (h *ServicesHandler) Sync(w http.ResponseWriter, r *http.Request) {
-	services, err := h.fileStore.Load()
+	services, err := h.serviceStore.Load()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
 		return
 	}
+	if isDryRun(r) {
+		h.previewSync(w, services)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	synced := 0
 	var errors []string
@@ -102,6 +271,10 @@ func (h *ServicesHandler) Sync(w http.ResponseWriter, r *http.Request) {
 	if len(errors) > 0 {
 		log.Printf("sync partial failure: %v", errors)
 	}
+	h.auditBatch(newAuditEntry(r, audit.ActionSync, ""), errors, map[string]any{
+		"synced": synced,
+		"total":  len(services),
+	})
 
 	writeJSON(w, map[string]any{
 		"synced": synced,
@@ -109,3 +282,76 @@ func (h *ServicesHandler) Sync(w http.ResponseWriter, r *http.Request) {
 		"errors": errors,
 	})
 }
+
+// Drift handles GET /api/services/drift (report only) and
+// POST /api/services/drift (admin: fix). It compares services.json with
+// the svc-* routes in Caddy. Fixing re-applies missing and changed routes
+// from the store and removes orphaned routes from Caddy.
+func (h *ServicesHandler) Drift(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Query().Get("fix") == "true" {
+		writeError(w, http.StatusMethodNotAllowed, "fixing drift changes Caddy: use POST /api/services/drift")
+		return
+	}
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+	cfg, err := h.caddyClient.GetConfig()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return
+	}
+
+	fix := r.Method == http.MethodPost
+
+	report := caddy.DetectDrift(cfg, services)
+	if !fix || !report.HasDrift() {
+		writeJSON(w, map[string]any{"drift": report.HasDrift(), "report": report})
+		return
+	}
+
+	fixed, errors := h.reconcile(newAuditEntry(r, audit.ActionDriftFix, ""), services, report)
+	if len(errors) > 0 {
+		log.Printf("drift fix partial failure: %v", errors)
+	}
+	writeJSON(w, map[string]any{
+		"drift":  true,
+		"report": report,
+		"fixed":  fixed,
+		"errors": errors,
+	})
+}
+
+// reconcile makes Caddy match the store for every entry in report and
+// records the outcome in e.
+func (h *ServicesHandler) reconcile(e audit.Entry, services []caddy.ServiceConfig, report caddy.DriftReport) (fixed, errors []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	byName := make(map[string]caddy.ServiceConfig, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	upsert := append([]string(nil), report.Missing...)
+	for _, c := range report.Changed {
+		upsert = append(upsert, c.Name)
+	}
+	for _, name := range upsert {
+		if err := h.caddyClient.UpsertRoute(byName[name]); err != nil {
+			errors = append(errors, name+": "+err.Error())
+		} else {
+			fixed = append(fixed, name)
+		}
+	}
+	for _, o := range report.Orphaned {
+		if err := h.caddyClient.RemoveRoute(o.Name); err != nil {
+			errors = append(errors, o.Name+": "+err.Error())
+		} else {
+			fixed = append(fixed, o.Name)
+		}
+	}
+	h.auditBatch(e, errors, map[string]any{"fixed": fixed, "report": report})
+	return fixed, errors
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"caddy-admin/caddy"
+	"errors"
 	"net/http"
-	"strings"
 )
 
 type SitesHandler struct {
@@ -29,7 +29,8 @@ func (h *SitesHandler) ListSites(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetSite handles GET /api/sites/{domain}
+// GetSite handles GET /api/sites/{domain}. A concrete hostname resolves
+// to the site serving it, including through aliases and wildcard patterns.
 func (h *SitesHandler) GetSite(w http.ResponseWriter, r *http.Request) {
 	domain := r.PathValue("domain")
 	if domain == "" {
@@ -43,16 +44,39 @@ func (h *SitesHandler) GetSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sites := caddy.ParseSites(cfg)
-	for _, s := range sites {
-		if strings.EqualFold(s.Domain, domain) {
-			writeJSON(w, s)
-			return
-		}
+	if s, ok := caddy.ResolveSite(caddy.ParseSites(cfg), domain); ok {
+		writeJSON(w, s)
+		return
 	}
 	writeError(w, http.StatusNotFound, "site not found: "+domain)
 }
 
+// Resolve handles GET /api/resolve?url=https://host/path: the routes a
+// request would pass through, the handler that answers and its upstream.
+func (h *SitesHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		writeError(w, http.StatusBadRequest, "url required")
+		return
+	}
+
+	cfg, err := h.caddyClient.GetConfig()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return
+	}
+
+	res, err := caddy.Resolve(cfg, target)
+	switch {
+	case errors.Is(err, caddy.ErrNoServer):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, res)
+	}
+}
+
 // Status handles GET /api/status
 func (h *SitesHandler) Status(w http.ResponseWriter, r *http.Request) {
 	running := h.caddyClient.IsRunning()
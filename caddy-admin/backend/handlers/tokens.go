@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/auth"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokensHandler manages API tokens. All routes require admin scope.
+type TokensHandler struct {
+	tokens *auth.TokenStore
+	authn  *auth.Authenticator
+	audit  *audit.Log
+}
+
+// NewTokensHandler creates a new TokensHandler. auditLog may be nil.
+func NewTokensHandler(tokens *auth.TokenStore, authn *auth.Authenticator, auditLog *audit.Log) *TokensHandler {
+	return &TokensHandler{tokens: tokens, authn: authn, audit: auditLog}
+}
+
+// tokenView is a token without its hash.
+type tokenView struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     auth.Scope `json:"scope"`
+	Prefix    string     `json:"prefix,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func newTokenView(t auth.Token) tokenView {
+	return tokenView{ID: t.ID, Name: t.Name, Scope: t.Scope, Prefix: t.Prefix, CreatedAt: t.CreatedAt}
+}
+
+// List handles GET /api/tokens
+func (h *TokensHandler) List(w http.ResponseWriter, r *http.Request) {
+	tokens := h.tokens.List()
+	views := make([]tokenView, 0, len(tokens))
+	for _, t := range tokens {
+		views = append(views, newTokenView(t))
+	}
+	writeJSON(w, map[string]any{"tokens": views, "total": len(views)})
+}
+
+// Create handles POST /api/tokens
+// The plaintext token is only returned in this response.
+func (h *TokensHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string     `json:"name"`
+		Scope  auth.Scope `json:"scope"`
+		Prefix string     `json:"prefix"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	plaintext, t, err := h.tokens.Create(req.Name, req.Scope, strings.TrimSpace(req.Prefix))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e := newAuditEntry(r, audit.ActionTokenCreate, t.ID)
+	e.Success = true
+	e.Details = newTokenView(t)
+	recordAudit(h.audit, e)
+
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]any{"token": plaintext, "info": newTokenView(t)})
+}
+
+// Delete handles DELETE /api/tokens/{id}
+// The last credential with admin scope cannot be revoked (409).
+func (h *TokensHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	found, err := h.authn.DeleteToken(id)
+	if errors.Is(err, auth.ErrLastAdmin) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		e := newAuditEntry(r, audit.ActionTokenDelete, id)
+		e.Error = "persist failed: " + err.Error()
+		recordAudit(h.audit, e)
+		writeError(w, http.StatusInternalServerError, "persist failed: "+err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "token not found: "+id)
+		return
+	}
+	e := newAuditEntry(r, audit.ActionTokenDelete, id)
+	e.Success = true
+	recordAudit(h.audit, e)
+	writeJSON(w, map[string]any{"deleted": true, "id": id})
+}
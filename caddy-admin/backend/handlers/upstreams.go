@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"caddy-admin/caddy"
+	"caddy-admin/store"
+	"net/http"
+)
+
+// UpstreamsHandler reports live upstream health for registered services.
+type UpstreamsHandler struct {
+	caddyClient  *caddy.Client
+	serviceStore store.ServiceStore
+}
+
+// NewUpstreamsHandler creates a new UpstreamsHandler.
+func NewUpstreamsHandler(client *caddy.Client, ss store.ServiceStore) *UpstreamsHandler {
+	return &UpstreamsHandler{caddyClient: client, serviceStore: ss}
+}
+
+// Upstream status values.
+const (
+	upstreamUp      = "up"      // in Caddy's pool with no recent failures
+	upstreamFailing = "failing" // requests to it have failed recently
+	upstreamMissing = "missing" // not in Caddy's pool (route absent or not loaded)
+)
+
+type upstreamHealth struct {
+	Address     string `json:"address"`
+	Status      string `json:"status"`
+	NumRequests int    `json:"numRequests"`
+	Fails       int    `json:"fails"`
+}
+
+type serviceHealth struct {
+	Name      string           `json:"name"`
+	Domain    string           `json:"domain"`
+	Healthy   bool             `json:"healthy"`
+	Upstreams []upstreamHealth `json:"upstreams"`
+}
+
+// List handles GET /api/upstreams
+func (h *UpstreamsHandler) List(w http.ResponseWriter, r *http.Request) {
+	services, err := h.serviceStore.Load()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load failed: "+err.Error())
+		return
+	}
+
+	live, err := h.caddyClient.GetUpstreams()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "cannot reach caddy: "+err.Error())
+		return
+	}
+
+	byAddr := make(map[string]caddy.UpstreamStatus, len(live))
+	for _, u := range live {
+		byAddr[u.Address] = u
+	}
+
+	claimed := make(map[string]bool)
+	result := make([]serviceHealth, 0, len(services))
+	for _, svc := range services {
+		sh := serviceHealth{Name: svc.Name, Domain: svc.Domain, Healthy: true}
+		for _, addr := range svc.UpstreamList() {
+			claimed[addr] = true
+			uh := upstreamHealth{Address: addr, Status: upstreamMissing}
+			if u, ok := byAddr[addr]; ok {
+				uh = newUpstreamHealth(u)
+			}
+			if uh.Status != upstreamUp {
+				sh.Healthy = false
+			}
+			sh.Upstreams = append(sh.Upstreams, uh)
+		}
+		result = append(result, sh)
+	}
+
+	// Upstreams from the Caddyfile or hand-edited routes
+	other := []upstreamHealth{}
+	for _, u := range live {
+		if !claimed[u.Address] {
+			other = append(other, newUpstreamHealth(u))
+		}
+	}
+
+	writeJSON(w, map[string]any{
+		"services": result,
+		"total":    len(result),
+		"other":    other,
+	})
+}
+
+func newUpstreamHealth(u caddy.UpstreamStatus) upstreamHealth {
+	status := upstreamUp
+	if u.Fails > 0 {
+		status = upstreamFailing
+	}
+	return upstreamHealth{
+		Address:     u.Address,
+		Status:      status,
+		NumRequests: u.NumRequests,
+		Fails:       u.Fails,
+	}
+}
@@ -0,0 +1,275 @@
+package history
+
+import (
+	"caddy-admin/caddy"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for a version that was never recorded or has
+// been pruned.
+var ErrNotFound = errors.New("version not found")
+
+// Snapshot is the full Caddy config and service registry at one point.
+type Snapshot struct {
+	Version
+	Config   json.RawMessage       `json:"config"`
+	Services []caddy.ServiceConfig `json:"services"`
+}
+
+// Version describes a snapshot without its contents.
+type Version struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"`
+	Reason  string    `json:"reason"`
+	Hash    string    `json:"hash"`
+	// ServiceCount is the number of registered services.
+	ServiceCount int `json:"serviceCount"`
+}
+
+// Store keeps numbered snapshots as one JSON file each, pruning all but
+// the newest limit. A nil *Store records nothing.
+type Store struct {
+	mu     sync.Mutex
+	dir    string
+	limit  int
+	latest Version
+}
+
+// Open opens the snapshot directory, creating it if needed. limit <= 0
+// keeps every version.
+func Open(dir string, limit int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, limit: limit}
+	versions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(versions); n > 0 {
+		s.latest = versions[n-1]
+	}
+	return s, nil
+}
+
+// Record saves a new version unless config and services are unchanged
+// since the latest one. It returns the version that now reflects them.
+func (s *Store) Record(actor, reason string, config json.RawMessage, services []caddy.ServiceConfig) (Version, error) {
+	if s == nil {
+		return Version{}, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := stateHash(config, services)
+	if s.latest.Version > 0 && s.latest.Hash == hash {
+		return s.latest, nil
+	}
+
+	if services == nil {
+		services = []caddy.ServiceConfig{}
+	}
+	snap := Snapshot{
+		Version: Version{
+			Version:      s.latest.Version + 1,
+			Time:         time.Now().UTC(),
+			Actor:        actor,
+			Reason:       reason,
+			Hash:         hash,
+			ServiceCount: len(services),
+		},
+		Config:   config,
+		Services: services,
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return Version{}, err
+	}
+	path := s.path(snap.Version.Version)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return Version{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return Version{}, err
+	}
+	s.latest = snap.Version
+	s.prune()
+	return s.latest, nil
+}
+
+// List returns every stored version, oldest first.
+func (s *Store) List() ([]Version, error) {
+	versions := []Version{}
+	if s == nil {
+		return versions, nil
+	}
+	names, err := filepath.Glob(filepath.Join(s.dir, "v*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var snap struct{ Version }
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(name), err)
+		}
+		versions = append(versions, snap.Version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// Latest returns the newest version, or a zero Version if none exist.
+func (s *Store) Latest() Version {
+	if s == nil {
+		return Version{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+// Get loads one snapshot.
+func (s *Store) Get(version int) (*Snapshot, error) {
+	if s == nil {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(version))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// prune removes versions beyond the limit. Errors are ignored; stale
+// files are retried on the next Record.
+func (s *Store) prune() {
+	if s.limit <= 0 {
+		return
+	}
+	for v := s.latest.Version - s.limit; v > 0; v-- {
+		if err := os.Remove(s.path(v)); os.IsNotExist(err) {
+			return
+		}
+	}
+}
+
+func (s *Store) path(version int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("v%06d.json", version))
+}
+
+// stateHash identifies a config and registry, ignoring lease expiry so
+// heartbeats alone never look like a change.
+func stateHash(config json.RawMessage, services []caddy.ServiceConfig) string {
+	h := sha256.New()
+	h.Write(config)
+	for _, svc := range withoutLeases(services) {
+		data, _ := json.Marshal(svc)
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func withoutLeases(services []caddy.ServiceConfig) []caddy.ServiceConfig {
+	out := make([]caddy.ServiceConfig, len(services))
+	for i, svc := range services {
+		svc.ExpiresAt = nil
+		out[i] = svc
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Diff is the difference between two snapshots.
+type Diff struct {
+	From     int                  `json:"from"`
+	To       int                  `json:"to"`
+	Services ServicesDiff         `json:"services"`
+	Config   []caddy.ConfigChange `json:"config"`
+}
+
+// ServicesDiff lists registry changes by service name.
+type ServicesDiff struct {
+	Added   []caddy.ServiceConfig `json:"added"`
+	Removed []caddy.ServiceConfig `json:"removed"`
+	Changed []ServiceChange       `json:"changed"`
+}
+
+// ServiceChange is one service whose config differs between snapshots.
+type ServiceChange struct {
+	Name   string              `json:"name"`
+	Before caddy.ServiceConfig `json:"before"`
+	After  caddy.ServiceConfig `json:"after"`
+}
+
+// Compare diffs snapshot a against b.
+func Compare(a, b *Snapshot) (Diff, error) {
+	changes, err := caddy.DiffConfig(a.Config, b.Config)
+	if err != nil {
+		return Diff{}, err
+	}
+	return Diff{
+		From:     a.Version.Version,
+		To:       b.Version.Version,
+		Services: DiffServices(a.Services, b.Services),
+		Config:   changes,
+	}, nil
+}
+
+// DiffServices compares two registries, ignoring lease expiry.
+func DiffServices(before, after []caddy.ServiceConfig) ServicesDiff {
+	d := ServicesDiff{
+		Added:   []caddy.ServiceConfig{},
+		Removed: []caddy.ServiceConfig{},
+		Changed: []ServiceChange{},
+	}
+	old := make(map[string]caddy.ServiceConfig, len(before))
+	for _, svc := range withoutLeases(before) {
+		old[svc.Name] = svc
+	}
+	seen := make(map[string]bool, len(after))
+	for _, svc := range withoutLeases(after) {
+		seen[svc.Name] = true
+		prev, ok := old[svc.Name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, svc)
+		case !reflect.DeepEqual(prev, svc):
+			d.Changed = append(d.Changed, ServiceChange{Name: svc.Name, Before: prev, After: svc})
+		}
+	}
+	for _, svc := range withoutLeases(before) {
+		if !seen[svc.Name] {
+			d.Removed = append(d.Removed, svc)
+		}
+	}
+	return d
+}
+
+// Reason formats a snapshot reason from an action and its target.
+func Reason(action, target string) string {
+	return strings.TrimSpace(action + " " + target)
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"caddy-admin/audit"
+	"caddy-admin/auth"
 	"caddy-admin/caddy"
+	"caddy-admin/certmon"
+	"caddy-admin/certwatch"
 	"caddy-admin/handlers"
+	"caddy-admin/history"
+	"caddy-admin/reconcile"
 	"caddy-admin/store"
+	"context"
+	"crypto/rand"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,89 +27,294 @@ func main() {
 	externalCertDir := getEnv("EXTERNAL_CERT_DIR", "")
 	listenAddr := getEnv("LISTEN_ADDR", ":8090")
 	servicesFile := getEnv("SERVICES_FILE", "/app/data/services.json")
+	servicesDB := getEnv("SERVICES_DB", "/app/data/services.db")
+	storeBackend := getEnv("SERVICES_STORE", store.BackendFile)
+	tokensFile := getEnv("TOKENS_FILE", "/app/data/tokens.json")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	allowedOrigins := getEnv("ALLOWED_ORIGINS", "")
+	auditFile := getEnv("AUDIT_FILE", "/app/data/audit.jsonl")
+	historyDir := getEnv("HISTORY_DIR", "/app/data/history")
+	if err := handlers.TrustProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 
 	caddyClient := caddy.NewClient(adminAddr)
-	fileStore := store.NewFileStore(servicesFile)
+	if server := os.Getenv("CADDY_SERVER"); server != "" {
+		caddyClient.UseServer(server)
+	}
+	storePath := servicesFile
+	if storeBackend == store.BackendBolt {
+		storePath = servicesDB
+	}
+	serviceStore, err := store.Open(storeBackend, storePath, servicesFile)
+	if err != nil {
+		log.Fatalf("open %s store at %s: %v", storeBackend, storePath, err)
+	}
+	caddyClient.UseRegistry(serviceStore.Load)
+	warnLegacyNames(serviceStore)
+
+	auditLog, err := audit.Open(auditFile)
+	if err != nil {
+		log.Fatalf("open audit log %s: %v", auditFile, err)
+	}
+
+	historyStore, err := history.Open(historyDir, getEnvInt("HISTORY_LIMIT", 50))
+	if err != nil {
+		log.Fatalf("open config history %s: %v", historyDir, err)
+	}
+
+	tokenStore, err := auth.NewTokenStore(tokensFile)
+	if err != nil {
+		log.Fatalf("load tokens from %s: %v", tokensFile, err)
+	}
+	authn := auth.NewAuthenticator(tokenStore, adminToken)
+	oidcRP := newOIDCFromEnv()
+	if oidcRP != nil {
+		authn.UseOIDC(oidcRP)
+	}
+	switch {
+	case getEnv("AUTH_DISABLED", "") == "true":
+		authn.Disable()
+		log.Println("auth disabled by AUTH_DISABLED=true: every caller is admin")
+	case !authn.HasAdmin() && tokenStore.Len() == 0 && oidcRP == nil:
+		log.Fatal("no credentials configured: set ADMIN_TOKEN or OIDC_ISSUER, or AUTH_DISABLED=true to run without auth")
+	case !authn.HasAdmin():
+		log.Println("no admin credential configured: set ADMIN_TOKEN to manage tokens")
+	}
+	read := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeRead, h) }
+	register := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeRegister, h) }
+	admin := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeAdmin, h) }
 
 	sitesHandler := handlers.NewSitesHandler(caddyClient)
 	certsHandler := handlers.NewCertsHandler(certStore, externalCertDir)
-	servicesHandler := handlers.NewServicesHandler(caddyClient, fileStore)
+	prober := &caddy.Prober{
+		Addr:    getEnv("TLS_PROBE_ADDR", defaultProbeAddr(adminAddr)),
+		Timeout: getEnvDuration("TLS_PROBE_TIMEOUT", 5*time.Second),
+	}
+	certsHandler.UseProber(prober, caddyClient, serviceStore)
+	servicesHandler := handlers.NewServicesHandler(caddyClient, serviceStore, auditLog, historyStore)
+	upstreamsHandler := handlers.NewUpstreamsHandler(caddyClient, serviceStore)
+	coverageHandler := handlers.NewCoverageHandler(caddyClient, serviceStore, certsHandler.Certs)
+
+	reconciler := reconcile.New(caddyClient, serviceStore, reconcile.Config{
+		Interval:   getEnvDuration("RECONCILE_INTERVAL", 10*time.Second),
+		MinBackoff: getEnvDuration("RECONCILE_MIN_BACKOFF", 2*time.Second),
+		MaxBackoff: getEnvDuration("RECONCILE_MAX_BACKOFF", time.Minute),
+	}, servicesHandler.Locker(), auditLog, historyStore)
+	reconcileHandler := handlers.NewReconcileHandler(reconciler)
+	tokensHandler := handlers.NewTokensHandler(tokenStore, authn, auditLog)
+	auditHandler := handlers.NewAuditHandler(auditLog)
+	historyHandler := handlers.NewHistoryHandler(historyStore)
+
+	certMonitor, err := certmon.New(certsHandler.Certs, certmon.Config{
+		Interval:      getEnvDuration("CERT_CHECK_INTERVAL", time.Hour),
+		Thresholds:    getEnvInts("CERT_ALERT_THRESHOLDS", certmon.DefaultThresholds),
+		StateFile:     getEnv("CERT_ALERT_STATE", "/app/data/cert-alerts.json"),
+		NotifyTimeout: getEnvDuration("CERT_ALERT_TIMEOUT", 30*time.Second),
+	}, notifiersFromEnv()...)
+	if err != nil {
+		log.Fatalf("cert monitor: %v", err)
+	}
+	certMonitorHandler := handlers.NewCertMonitorHandler(certMonitor)
+
+	var certWatcher *certwatch.Watcher
+	if externalCertDir != "" {
+		certWatcher = certwatch.New(caddyClient, externalCertDir,
+			getEnvDuration("CERT_WATCH_INTERVAL", 30*time.Second), servicesHandler.Locker(), auditLog)
+		certWatcher.UseProber(prober, certsHandler.ProbeHosts)
+	}
+	certReloadHandler := handlers.NewCertReloadHandler(certWatcher)
 
 	mux := http.NewServeMux()
 
 	// CORS middleware wrapper
-	handler := withCORS(mux)
+	handler := withCORS(mux, allowedOrigins)
 
-	// Existing routes
+	// Existing routes (status stays public for liveness checks)
 	mux.HandleFunc("GET /api/status", sitesHandler.Status)
-	mux.HandleFunc("GET /api/sites", sitesHandler.ListSites)
-	mux.HandleFunc("GET /api/sites/{domain}", sitesHandler.GetSite)
-	mux.HandleFunc("GET /api/certs", certsHandler.ListCerts)
+	mux.HandleFunc("GET /api/sites", read(sitesHandler.ListSites))
+	mux.HandleFunc("GET /api/sites/{domain}", read(sitesHandler.GetSite))
+	mux.HandleFunc("GET /api/resolve", read(sitesHandler.Resolve))
+	mux.HandleFunc("GET /api/certs", read(certsHandler.ListCerts))
+	mux.HandleFunc("GET /api/certs/alerts", read(certMonitorHandler.Status))
+	mux.HandleFunc("GET /api/certs/coverage", read(coverageHandler.Coverage))
+	mux.HandleFunc("GET /api/certs/reload", read(certReloadHandler.Status))
+	mux.HandleFunc("GET /api/certs/{fingerprint}", read(certsHandler.GetCert))
+	mux.HandleFunc("POST /api/certs/alerts/test", admin(certMonitorHandler.Test))
+	mux.HandleFunc("POST /api/certs/reload", admin(certReloadHandler.Reload))
+
+	// Service registration routes. Register-scoped tokens are further
+	// limited to their own name prefix inside the handlers.
+	mux.HandleFunc("GET /api/services", read(servicesHandler.List))
+	mux.HandleFunc("POST /api/services", register(servicesHandler.Register))
+	mux.HandleFunc("PUT /api/services/{name}", register(servicesHandler.Update))
+	mux.HandleFunc("PATCH /api/services/{name}", register(servicesHandler.Update))
+	mux.HandleFunc("DELETE /api/services/{name}", register(servicesHandler.Deregister))
+	mux.HandleFunc("POST /api/services/{name}/heartbeat", register(servicesHandler.Heartbeat))
+	mux.HandleFunc("POST /api/services/sync", admin(servicesHandler.Sync))
+	mux.HandleFunc("GET /api/services/drift", read(servicesHandler.Drift))
+	mux.HandleFunc("POST /api/services/drift", admin(servicesHandler.Drift))
+	mux.HandleFunc("GET /api/upstreams", read(upstreamsHandler.List))
+	mux.HandleFunc("GET /api/reconciler", read(reconcileHandler.Status))
+
+	// Dashboard login (OIDC) and current identity
+	mux.HandleFunc("GET /api/auth/me", read(auth.Me))
+	if oidcRP != nil {
+		mux.HandleFunc("GET /api/auth/login", oidcRP.Login)
+		mux.HandleFunc("GET /api/auth/callback", oidcRP.Callback)
+		mux.HandleFunc("POST /api/auth/logout", oidcRP.Logout)
+	}
+
+	// Token management
+	mux.HandleFunc("GET /api/tokens", admin(tokensHandler.List))
+	mux.HandleFunc("POST /api/tokens", admin(tokensHandler.Create))
+	mux.HandleFunc("DELETE /api/tokens/{id}", admin(tokensHandler.Delete))
+
+	// Audit trail of every mutation
+	mux.HandleFunc("GET /api/audit", admin(auditHandler.List))
 
-	// Service registration routes
-	mux.HandleFunc("GET /api/services", servicesHandler.List)
-	mux.HandleFunc("POST /api/services", servicesHandler.Register)
-	mux.HandleFunc("DELETE /api/services/{name}", servicesHandler.Deregister)
-	mux.HandleFunc("POST /api/services/sync", servicesHandler.Sync)
+	// Config history: versioned snapshots of /config/ and the registry
+	mux.HandleFunc("GET /api/history", read(historyHandler.List))
+	mux.HandleFunc("GET /api/history/diff", admin(historyHandler.Diff))
+	mux.HandleFunc("GET /api/history/{version}", admin(historyHandler.Get))
+	mux.HandleFunc("POST /api/history/{version}/rollback", admin(servicesHandler.Rollback))
 
-	// Sync persisted services to Caddy on startup
-	go syncToCaddy(caddyClient, fileStore)
+	// Keep persisted services routed in Caddy, replaying them after
+	// Caddy restarts or reloads
+	go reconciler.Run(context.Background())
 
-	log.Printf("caddy-admin API listening on %s (caddy at %s)", listenAddr, adminAddr)
+	// Alert before certificates expire
+	go certMonitor.Run(context.Background())
+
+	// Load renewed external certificates into Caddy without a restart
+	if certWatcher != nil {
+		go certWatcher.Run(context.Background())
+	}
+
+	// Deregister services whose ttl lease was not renewed by a heartbeat
+	go servicesHandler.RunReaper(context.Background(), getEnvDuration("REAPER_INTERVAL", 15*time.Second))
+
+	log.Printf("caddy-admin API listening on %s (caddy at %s, %s store at %s)", listenAddr, adminAddr, storeBackend, storePath)
 	if err := http.ListenAndServe(listenAddr, handler); err != nil {
 		log.Fatal(err)
 	}
 }
 
-// syncToCaddy waits for Caddy to become ready, then replays all persisted services.
-func syncToCaddy(client *caddy.Client, fs *store.FileStore) {
-	// Wait for Caddy to be ready
-	for i := 0; i < 15; i++ {
-		if client.IsRunning() {
-			break
+// withCORS allows cross-origin calls from the comma-separated origins
+// list ("*" for any). The dashboard is served same-origin through Caddy,
+// so the default empty list sends no CORS headers at all.
+func withCORS(next http.Handler, origins string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, o := range strings.Split(origins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed[o] = true
 		}
-		log.Printf("sync: waiting for caddy... (%d/15)", i+1)
-		time.Sleep(2 * time.Second)
 	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case allowed["*"]:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && allowed[origin]:
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if !client.IsRunning() {
-		log.Println("sync: caddy not ready after 30s, skipping")
-		return
+// newOIDCFromEnv configures dashboard SSO when OIDC_ISSUER is set.
+func newOIDCFromEnv() *auth.OIDC {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
 	}
-
-	services, err := fs.Load()
+	roleMap, err := auth.ParseRoleMap(os.Getenv("OIDC_ROLE_MAP"))
 	if err != nil {
-		log.Printf("sync: load services failed: %v", err)
-		return
+		log.Fatalf("OIDC_ROLE_MAP: %v", err)
 	}
-
-	if len(services) == 0 {
-		log.Println("sync: no persisted services")
-		return
+	defaultRole := os.Getenv("OIDC_DEFAULT_ROLE")
+	if defaultRole != "" {
+		if err := auth.ValidateRole(defaultRole); err != nil {
+			log.Fatalf("OIDC_DEFAULT_ROLE: %v", err)
+		}
 	}
 
-	synced := 0
-	for _, svc := range services {
-		if err := client.UpsertRoute(svc); err != nil {
-			log.Printf("sync: failed to upsert %s: %v", svc.Name, err)
-		} else {
-			synced++
+	key := []byte(os.Getenv("SESSION_SECRET"))
+	if len(key) < 32 {
+		log.Println("oidc: SESSION_SECRET missing or shorter than 32 bytes, using a random key (sessions end on restart)")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal(err)
 		}
 	}
-	log.Printf("sync: restored %d/%d services to caddy", synced, len(services))
+
+	var scopes []string
+	if v := os.Getenv("OIDC_SCOPES"); v != "" {
+		scopes = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	}
+	redirect := os.Getenv("OIDC_REDIRECT_URL")
+	log.Printf("oidc: dashboard login via %s", issuer)
+	return auth.NewOIDC(auth.OIDCConfig{
+		IssuerURL:     issuer,
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   redirect,
+		Scopes:        scopes,
+		GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		RoleMap:       roleMap,
+		DefaultRole:   defaultRole,
+		SessionTTL:    getEnvDuration("SESSION_TTL", 8*time.Hour),
+		SecureCookies: strings.HasPrefix(redirect, "https://"),
+	}, auth.NewSigner(key))
 }
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
+// defaultProbeAddr is Caddy's HTTPS listener on the admin API's host.
+func defaultProbeAddr(adminAddr string) string {
+	host, _, err := net.SplitHostPort(adminAddr)
+	if err != nil {
+		host = adminAddr
+	}
+	return net.JoinHostPort(host, "443")
+}
+
+// notifiersFromEnv returns the cert alert notifiers that are configured.
+func notifiersFromEnv() []certmon.Notifier {
+	var notifiers []certmon.Notifier
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &certmon.Webhook{URL: url})
+	}
+	if url := os.Getenv("ALERT_SLACK_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, &certmon.Slack{URL: url})
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		var to []string
+		for _, t := range strings.Split(os.Getenv("SMTP_TO"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				to = append(to, t)
+			}
 		}
-		next.ServeHTTP(w, r)
-	})
+		if len(to) == 0 {
+			log.Fatal("SMTP_ADDR is set but SMTP_TO is empty")
+		}
+		notifiers = append(notifiers, &certmon.SMTP{
+			Addr:     addr,
+			From:     getEnv("SMTP_FROM", "caddy-admin@localhost"),
+			To:       to,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		})
+	}
+	if len(notifiers) == 0 {
+		log.Println("certmon: no notifiers configured, expiring certs are only shown in /api/certs/alerts")
+	}
+	return notifiers
 }
 
 func getEnv(key, fallback string) string {
@@ -107,3 +323,61 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// warnLegacyNames logs stored services whose names predate the name
+// rules. They keep working, but cannot be registered again under that name.
+func warnLegacyNames(ss store.ServiceStore) {
+	services, err := ss.Load()
+	if err != nil {
+		return
+	}
+	for _, svc := range services {
+		if err := caddy.ValidateName(svc.Name); err != nil {
+			log.Printf("service %q: %v; it can still be updated and removed, re-register it under a valid name", svc.Name, err)
+		}
+	}
+}
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvInts parses a comma-separated list such as "30,14,7,1".
+func getEnvInts(key string, fallback []int) []int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var out []int
+	for _, f := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n <= 0 {
+			log.Printf("invalid %s=%q, using %v", key, v, fallback)
+			return fallback
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,295 @@
+package reconcile
+
+import (
+	"caddy-admin/audit"
+	"caddy-admin/caddy"
+	"caddy-admin/history"
+	"caddy-admin/store"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Config controls how often the reconciler checks Caddy.
+type Config struct {
+	// Interval between checks while Caddy is reachable.
+	Interval time.Duration
+	// MinBackoff and MaxBackoff bound the exponential wait used while
+	// Caddy is unreachable or a replay fails.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultConfig returns the intervals used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Interval:   10 * time.Second,
+		MinBackoff: 2 * time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// Status is the outcome of the most recent reconciliation pass.
+type Status struct {
+	Running             bool      `json:"running"`
+	CaddyUp             bool      `json:"caddyUp"`
+	ConfigHash          string    `json:"configHash,omitempty"`
+	LastRun             time.Time `json:"lastRun"`
+	LastChange          time.Time `json:"lastChange"` // last time the config hash changed
+	LastReplay          time.Time `json:"lastReplay"`
+	LastReplayed        []string  `json:"lastReplayed,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	NextRun             time.Time `json:"nextRun"`
+}
+
+// Reconciler keeps Caddy's svc-* routes in line with the service store.
+// It polls /config/ and, whenever the document hash changes (a Caddy
+// restart, a reload or a hand edit), replays services that are missing
+// or differ. Routes that exist only in Caddy are left alone; use
+// POST /api/services/drift to remove them.
+type Reconciler struct {
+	client *caddy.Client
+	store  store.ServiceStore
+	cfg    Config
+	// lock is shared with the services handler so a replay never
+	// interleaves with a register or deregister.
+	lock    sync.Locker
+	audit   *audit.Log
+	history *history.Store
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// New creates a Reconciler. lock may be nil when nothing else mutates
+// Caddy; auditLog and hist may be nil to skip recording replays.
+func New(client *caddy.Client, ss store.ServiceStore, cfg Config, lock sync.Locker, auditLog *audit.Log, hist *history.Store) *Reconciler {
+	def := DefaultConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = def.MinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	if lock == nil {
+		lock = &sync.Mutex{}
+	}
+	return &Reconciler{client: client, store: ss, cfg: cfg, lock: lock, audit: auditLog, history: hist}
+}
+
+// Status returns a snapshot of the last run.
+func (r *Reconciler) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := r.status
+	s.LastReplayed = append([]string(nil), r.status.LastReplayed...)
+	return s
+}
+
+// Run loops until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	r.update(func(s *Status) { s.Running = true })
+	defer r.update(func(s *Status) { s.Running = false })
+
+	changes := r.store.Watch(ctx)
+	force := false
+	backoff := r.cfg.MinBackoff
+	for {
+		wait := r.cfg.Interval
+		if err := r.runOnce(force); err != nil {
+			wait = backoff
+			backoff *= 2
+			if backoff > r.cfg.MaxBackoff {
+				backoff = r.cfg.MaxBackoff
+			}
+		} else {
+			backoff = r.cfg.MinBackoff
+		}
+		r.update(func(s *Status) { s.NextRun = time.Now().Add(wait) })
+
+		force = false
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		case <-changes:
+			// The registry changed: check drift even if Caddy's config
+			// looks the same as last time.
+			force = true
+		}
+	}
+}
+
+// runOnce performs one check and, if the config changed (or force is
+// set), one replay.
+func (r *Reconciler) runOnce(force bool) error {
+	now := time.Now()
+	raw, err := r.client.GetConfigRaw()
+	if err != nil {
+		r.fail(now, false, err)
+		return err
+	}
+	hash := hashConfig(raw)
+
+	prev := r.Status()
+	if !force && prev.CaddyUp && hash == prev.ConfigHash && prev.LastError == "" {
+		r.update(func(s *Status) {
+			s.LastRun = now
+			s.ConsecutiveFailures = 0
+		})
+		return nil
+	}
+
+	changed := hash != prev.ConfigHash
+	replayed, hash, err := r.replay(raw, hash)
+	if err != nil {
+		r.fail(now, true, err)
+		return err
+	}
+
+	// Snapshot config changes made outside caddy-admin (including the
+	// state at startup) so they can be rolled back to as well.
+	switch {
+	case len(replayed) > 0:
+		r.snapshot("reconciler replay")
+	case changed:
+		r.snapshot("caddy config changed")
+	}
+
+	r.update(func(s *Status) {
+		if changed {
+			s.LastChange = now
+		}
+		s.CaddyUp = true
+		s.ConfigHash = hash
+		s.LastRun = now
+		s.LastError = ""
+		s.ConsecutiveFailures = 0
+		if len(replayed) > 0 {
+			s.LastReplay = now
+			s.LastReplayed = replayed
+		}
+	})
+	return nil
+}
+
+// replay re-applies every stored service whose route is missing or
+// different and returns the config hash after the replay.
+func (r *Reconciler) replay(raw []byte, hash string) ([]string, string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	services, err := r.store.Load()
+	if err != nil {
+		return nil, hash, err
+	}
+	var cfg caddy.CaddyConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, hash, err
+	}
+
+	report := caddy.DetectDrift(&cfg, services)
+	if len(report.Missing) == 0 && len(report.Changed) == 0 {
+		return nil, hash, nil
+	}
+
+	byName := make(map[string]caddy.ServiceConfig, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+	names := append([]string(nil), report.Missing...)
+	for _, c := range report.Changed {
+		names = append(names, c.Name)
+	}
+
+	var replayed []string
+	var firstErr error
+	for _, name := range names {
+		svc := byName[name]
+		err := r.client.UpsertRoute(svc)
+		r.record(svc, err)
+		if err != nil {
+			log.Printf("reconcile: failed to upsert %s: %v", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		replayed = append(replayed, name)
+	}
+	log.Printf("reconcile: replayed %d/%d services to caddy", len(replayed), len(names))
+	if firstErr != nil {
+		return replayed, hash, firstErr
+	}
+
+	// Remember the post-replay hash so our own writes don't trigger
+	// another pass.
+	after, err := r.client.GetConfigRaw()
+	if err != nil {
+		return replayed, hash, err
+	}
+	return replayed, hashConfig(after), nil
+}
+
+// record adds a replay of svc to the audit log.
+func (r *Reconciler) record(svc caddy.ServiceConfig, err error) {
+	e := audit.Entry{Actor: "reconciler", Action: audit.ActionReplay, Target: svc.Name, After: &svc, Success: err == nil, Caddy: "ok"}
+	if err != nil {
+		e.Error = err.Error()
+		e.Caddy = err.Error()
+	}
+	if err := r.audit.Record(e); err != nil {
+		log.Printf("reconcile: audit %s failed: %v", svc.Name, err)
+	}
+}
+
+// snapshot records the current config and registry in the history.
+func (r *Reconciler) snapshot(reason string) {
+	if r.history == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	raw, err := r.client.GetConfigRaw()
+	if err != nil {
+		log.Printf("reconcile: history snapshot failed: %v", err)
+		return
+	}
+	services, err := r.store.Load()
+	if err != nil {
+		log.Printf("reconcile: history snapshot failed: %v", err)
+		return
+	}
+	if _, err := r.history.Record("reconciler", reason, raw, services); err != nil {
+		log.Printf("reconcile: history snapshot failed: %v", err)
+	}
+}
+
+func (r *Reconciler) fail(now time.Time, caddyUp bool, err error) {
+	r.update(func(s *Status) {
+		s.CaddyUp = caddyUp
+		s.LastRun = now
+		s.LastError = err.Error()
+		s.ConsecutiveFailures++
+	})
+}
+
+func (r *Reconciler) update(fn func(*Status)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.status)
+}
+
+func hashConfig(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
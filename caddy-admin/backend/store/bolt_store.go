@@ -0,0 +1,160 @@
+package store
+
+import (
+	"caddy-admin/caddy"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	servicesBucket = []byte("services")
+	metaBucket     = []byte("meta")
+	// importedKey records the JSON file imported by ImportOnce.
+	importedKey = []byte("imported")
+)
+
+// BoltStore persists ServiceConfig entries in an embedded bbolt database,
+// one key per service, so a change rewrites only that service.
+type BoltStore struct {
+	db      *bolt.DB
+	changes notifier
+}
+
+// NewBoltStore opens (or creates) the database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(servicesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// ImportOnce copies the services from a FileStore JSON file into an empty
+// database and returns how many were imported. It runs at most once per
+// database, so services deleted afterwards are not brought back; a
+// missing file is not an error.
+func (bs *BoltStore) ImportOnce(file string) (int, error) {
+	if file == "" {
+		return 0, nil
+	}
+	services, err := NewFileStore(file).Load()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		meta, b := tx.Bucket(metaBucket), tx.Bucket(servicesBucket)
+		if meta.Get(importedKey) != nil || b.Stats().KeyN > 0 {
+			return nil
+		}
+		for _, svc := range services {
+			data, err := json.Marshal(svc)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(svc.Name), data); err != nil {
+				return err
+			}
+			n++
+		}
+		return meta.Put(importedKey, []byte(file))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		bs.changes.notify()
+	}
+	return n, nil
+}
+
+// Close releases the database file lock.
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+// Load returns all stored services ordered by name.
+func (bs *BoltStore) Load() ([]caddy.ServiceConfig, error) {
+	services := []caddy.ServiceConfig{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(servicesBucket).ForEach(func(_, v []byte) error {
+			var svc caddy.ServiceConfig
+			if err := json.Unmarshal(v, &svc); err != nil {
+				return err
+			}
+			services = append(services, svc)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// Get returns the service with the given name and whether it exists.
+func (bs *BoltStore) Get(name string) (caddy.ServiceConfig, bool, error) {
+	var svc caddy.ServiceConfig
+	var found bool
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(servicesBucket).Get([]byte(name))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &svc)
+	})
+	return svc, found, err
+}
+
+// Upsert adds or updates a service by name.
+func (bs *BoltStore) Upsert(svc caddy.ServiceConfig) error {
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(servicesBucket).Put([]byte(svc.Name), data)
+	})
+	if err != nil {
+		return err
+	}
+	bs.changes.notify()
+	return nil
+}
+
+// Delete removes a service by name. No error if not found.
+func (bs *BoltStore) Delete(name string) error {
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(servicesBucket).Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	bs.changes.notify()
+	return nil
+}
+
+// Watch notifies after every Upsert or Delete.
+func (bs *BoltStore) Watch(ctx context.Context) <-chan struct{} {
+	return bs.changes.watch(ctx)
+}
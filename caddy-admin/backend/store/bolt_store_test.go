@@ -0,0 +1,64 @@
+package store
+
+import (
+	"caddy-admin/caddy"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenBoltImportsJSONOnce(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "services.json")
+	dbFile := filepath.Join(dir, "services.db")
+
+	fs := NewFileStore(jsonFile)
+	for _, name := range []string{"api", "web"} {
+		if err := fs.Upsert(caddy.ServiceConfig{Name: name, Domain: name + ".test", Upstream: name + ":80"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	open := func() *BoltStore {
+		t.Helper()
+		ss, err := Open(BackendBolt, dbFile, jsonFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss.(*BoltStore)
+	}
+
+	bs := open()
+	services, err := bs.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || services[0].Name != "api" || services[1].Upstream != "web:80" {
+		t.Fatalf("imported %+v, want api and web", services)
+	}
+
+	// Deleting everything must not bring the JSON services back.
+	for _, svc := range services {
+		if err := bs.Delete(svc.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs.Close()
+
+	bs = open()
+	defer bs.Close()
+	if services, _ := bs.Load(); len(services) != 0 {
+		t.Errorf("reopened store has %d services, want 0 (import must run once)", len(services))
+	}
+}
+
+func TestOpenBoltWithoutJSON(t *testing.T) {
+	dir := t.TempDir()
+	ss, err := Open(BackendBolt, filepath.Join(dir, "services.db"), filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.(*BoltStore).Close()
+	if services, _ := ss.Load(); len(services) != 0 {
+		t.Errorf("got %d services, want 0", len(services))
+	}
+}
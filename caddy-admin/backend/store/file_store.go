@@ -2,6 +2,7 @@ package store
 
 import (
 	"caddy-admin/caddy"
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -10,8 +11,9 @@ import (
 
 // FileStore persists ServiceConfig entries to a JSON file.
 type FileStore struct {
-	mu   sync.RWMutex
-	path string
+	mu      sync.RWMutex
+	path    string
+	changes notifier
 }
 
 // NewFileStore creates a FileStore at the given path.
@@ -26,6 +28,23 @@ func (fs *FileStore) Load() ([]caddy.ServiceConfig, error) {
 	return fs.unsafeLoad()
 }
 
+// Get returns the service with the given name and whether it exists.
+func (fs *FileStore) Get(name string) (caddy.ServiceConfig, bool, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	services, err := fs.unsafeLoad()
+	if err != nil {
+		return caddy.ServiceConfig{}, false, err
+	}
+	for _, s := range services {
+		if s.Name == name {
+			return s, true, nil
+		}
+	}
+	return caddy.ServiceConfig{}, false, nil
+}
+
 // Upsert adds or updates a service by name.
 func (fs *FileStore) Upsert(svc caddy.ServiceConfig) error {
 	fs.mu.Lock()
@@ -47,7 +66,11 @@ func (fs *FileStore) Upsert(svc caddy.ServiceConfig) error {
 	if !found {
 		services = append(services, svc)
 	}
-	return fs.unsafeSave(services)
+	if err := fs.unsafeSave(services); err != nil {
+		return err
+	}
+	fs.changes.notify()
+	return nil
 }
 
 // Delete removes a service by name. No error if not found.
@@ -66,7 +89,17 @@ func (fs *FileStore) Delete(name string) error {
 			filtered = append(filtered, s)
 		}
 	}
-	return fs.unsafeSave(filtered)
+	if err := fs.unsafeSave(filtered); err != nil {
+		return err
+	}
+	fs.changes.notify()
+	return nil
+}
+
+// Watch notifies after every Upsert or Delete made through this store.
+// Edits to the file by other processes are not detected.
+func (fs *FileStore) Watch(ctx context.Context) <-chan struct{} {
+	return fs.changes.watch(ctx)
 }
 
 func (fs *FileStore) unsafeLoad() ([]caddy.ServiceConfig, error) {
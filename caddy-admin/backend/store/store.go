@@ -0,0 +1,93 @@
+package store
+
+import (
+	"caddy-admin/caddy"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ServiceStore persists registered services.
+type ServiceStore interface {
+	// Load returns all stored services.
+	Load() ([]caddy.ServiceConfig, error)
+	// Get returns the service with the given name and whether it exists.
+	Get(name string) (caddy.ServiceConfig, bool, error)
+	// Upsert adds or updates a service by name.
+	Upsert(svc caddy.ServiceConfig) error
+	// Delete removes a service by name. No error if not found.
+	Delete(name string) error
+	// Watch returns a channel that receives a value after changes made
+	// through this store. Bursts may be coalesced into one notification.
+	// The channel is closed when ctx is done.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// Backend names accepted by Open.
+const (
+	BackendFile = "file"
+	BackendBolt = "bolt"
+)
+
+// Open returns the ServiceStore for backend ("file" or "bolt") at path.
+// A new bolt database imports the services in jsonFile, the file backend's
+// registry, so switching backends keeps the registered services.
+func Open(backend, path, jsonFile string) (ServiceStore, error) {
+	switch backend {
+	case "", BackendFile:
+		return NewFileStore(path), nil
+	case BackendBolt:
+		bs, err := NewBoltStore(path)
+		if err != nil {
+			return nil, err
+		}
+		n, err := bs.ImportOnce(jsonFile)
+		if err != nil {
+			bs.Close()
+			return nil, fmt.Errorf("import %s: %w", jsonFile, err)
+		}
+		if n > 0 {
+			log.Printf("store: imported %d services from %s into %s", n, jsonFile, path)
+		}
+		return bs, nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q (want %s or %s)", backend, BackendFile, BackendBolt)
+	}
+}
+
+// notifier fans out change notifications to Watch subscribers.
+type notifier struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func (n *notifier) watch(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	if n.subs == nil {
+		n.subs = make(map[chan struct{}]struct{})
+	}
+	n.subs[ch] = struct{}{}
+	n.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		n.mu.Lock()
+		delete(n.subs, ch)
+		n.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+func (n *notifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // a notification is already pending
+		}
+	}
+}
@@ -1,9 +1,10 @@
 #!/bin/bash
 # deploy.sh — Deploy caddy-admin to ECS (run locally)
-# Usage: ECS_IP=1.2.3.4 ./deploy/deploy.sh
+# Usage: ECS_IP=1.2.3.4 CADDY_ADMIN_TOKEN=... ./deploy/deploy.sh
 set -e
 
 ECS_IP="${ECS_IP:?set ECS_IP}"
+CADDY_ADMIN_TOKEN="${CADDY_ADMIN_TOKEN:?set CADDY_ADMIN_TOKEN (the API refuses to start without it)}"
 ECS_USER="${ECS_USER:-root}"
 PROJECT="caddy-admin"
 PORT=8090
@@ -20,7 +21,7 @@ rsync -avz caddy-admin/backend/ ${ECS_USER}@${ECS_IP}:/opt/${PROJECT}/
 
 ssh ${ECS_USER}@${ECS_IP} "
   cd /opt/${PROJECT}
-  docker compose -f deploy/docker-compose.yml up -d --build
+  CADDY_ADMIN_TOKEN='${CADDY_ADMIN_TOKEN}' docker compose -f deploy/docker-compose.yml up -d --build
 "
 
 echo "=== [4/4] Update Caddyfile + reload ==="
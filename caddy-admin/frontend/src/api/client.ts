@@ -1,9 +1,35 @@
-import type { CertsResponse, ServicesResponse, SiteInfo, SitesResponse, StatusResponse } from '../types'
+import type { CertsResponse, ServicesResponse, SiteInfo, SitesResponse, StatusResponse, UpstreamsResponse } from '../types'
 
 const BASE = '/api'
+const TOKEN_KEY = 'caddyAdminToken'
+
+// Sends the SSO session cookie or stored API token. On 401 it redirects
+// to SSO login when the backend offers it, otherwise asks for a token once.
+async function request(path: string, init: RequestInit = {}): Promise<Response> {
+  const send = () => {
+    const token = localStorage.getItem(TOKEN_KEY)
+    const headers = new Headers(init.headers)
+    if (token) headers.set('Authorization', `Bearer ${token}`)
+    return fetch(BASE + path, { ...init, headers, credentials: 'same-origin' })
+  }
+  let res = await send()
+  if (res.status === 401) {
+    const body = await res.clone().json().catch(() => ({}))
+    if (body.login) {
+      window.location.href = `${body.login}?return=${encodeURIComponent(window.location.pathname)}`
+      return res
+    }
+    const token = window.prompt('caddy-admin API token')
+    if (token) {
+      localStorage.setItem(TOKEN_KEY, token.trim())
+      res = await send()
+    }
+  }
+  return res
+}
 
 async function get<T>(path: string): Promise<T> {
-  const res = await fetch(BASE + path)
+  const res = await request(path)
   if (!res.ok) {
     const err = await res.json().catch(() => ({ error: res.statusText }))
     throw new Error(err.error ?? 'request failed')
@@ -12,7 +38,7 @@ async function get<T>(path: string): Promise<T> {
 }
 
 async function del<T>(path: string): Promise<T> {
-  const res = await fetch(BASE + path, { method: 'DELETE' })
+  const res = await request(path, { method: 'DELETE' })
   if (!res.ok) {
     const err = await res.json().catch(() => ({ error: res.statusText }))
     throw new Error(err.error ?? 'request failed')
@@ -26,5 +52,6 @@ export const api = {
   site: (domain: string) => get<SiteInfo>(`/sites/${encodeURIComponent(domain)}`),
   certs: () => get<CertsResponse>('/certs'),
   services: () => get<ServicesResponse>('/services'),
+  upstreams: () => get<UpstreamsResponse>('/upstreams'),
   deleteService: (name: string) => del<{ deleted: boolean; name: string }>(`/services/${encodeURIComponent(name)}`),
 }
@@ -77,8 +77,11 @@ export default function CertList() {
             </thead>
             <tbody>
               {certs.map(cert => (
-                <tr key={cert.domain}>
-                  <td style={{ ...s.td, fontWeight: 600 }}>{cert.domain}</td>
+                <tr key={cert.fingerprint}>
+                  <td style={{ ...s.td, fontWeight: 600 }} title={cert.sans.join(', ')}>
+                    {cert.domain}
+                    {cert.sans.length > 1 && <span style={{ color: '#64748b', fontWeight: 400 }}> +{cert.sans.length - 1}</span>}
+                  </td>
                   <td style={{ ...s.td, color: '#475569' }}>{cert.issuer || '—'}</td>
                   <td style={s.td}>{sourceBadge(cert.source)}</td>
                   <td style={{ ...s.td, color: '#475569', fontFamily: 'monospace', fontSize: 13 }}>{fmtDate(cert.notAfter)}</td>
@@ -1,5 +1,5 @@
 import { useEffect, useState } from 'react'
-import type { ServiceInfo } from '../types'
+import type { ServiceHealth, ServiceInfo } from '../types'
 import { api } from '../api/client'
 
 const s: Record<string, React.CSSProperties> = {
@@ -10,6 +10,9 @@ const s: Record<string, React.CSSProperties> = {
   td: { padding: '14px 16px', fontSize: 14, borderBottom: '1px solid #f1f5f9' },
   error: { padding: '20px 16px', color: '#dc2626', fontSize: 14 },
   empty: { padding: '40px 16px', textAlign: 'center', color: '#94a3b8', fontSize: 14 },
+  badge: { display: 'inline-block', padding: '2px 8px', borderRadius: 9999, fontSize: 12, fontWeight: 500 },
+  up: { background: '#dcfce7', color: '#15803d' },
+  down: { background: '#fee2e2', color: '#b91c1c' },
   deleteBtn: { background: 'none', border: 'none', color: '#dc2626', cursor: 'pointer', fontSize: 13, fontWeight: 500, padding: '4px 8px' },
   deleteBtnDisabled: { background: 'none', border: 'none', color: '#94a3b8', cursor: 'not-allowed', fontSize: 13, fontWeight: 500, padding: '4px 8px' },
 }
@@ -19,12 +22,16 @@ export default function ServiceList() {
   const [loading, setLoading] = useState(true)
   const [error, setError] = useState<string | null>(null)
   const [deleting, setDeleting] = useState<string | null>(null)
+  const [health, setHealth] = useState<Record<string, ServiceHealth>>({})
 
   useEffect(() => {
     api.services()
       .then(r => setServices(r.services ?? []))
       .catch(e => setError(e.message))
       .finally(() => setLoading(false))
+    api.upstreams()
+      .then(r => setHealth(Object.fromEntries(r.services.map(h => [h.name, h]))))
+      .catch(() => setHealth({}))
   }, [])
 
   async function handleDelete(name: string) {
@@ -57,15 +64,27 @@ export default function ServiceList() {
                 <th style={s.th}>Name</th>
                 <th style={s.th}>Domain</th>
                 <th style={s.th}>Upstream</th>
+                <th style={s.th}>Health</th>
                 <th style={s.th}>Action</th>
               </tr>
             </thead>
             <tbody>
               {services.map(svc => (
                 <tr key={svc.name}>
-                  <td style={{ ...s.td, fontWeight: 600 }}>{svc.name}</td>
-                  <td style={{ ...s.td, color: '#475569' }}>{svc.domain}</td>
-                  <td style={{ ...s.td, fontFamily: 'monospace', fontSize: 13, color: '#475569' }}>{svc.upstream}</td>
+                  <td style={{ ...s.td, fontWeight: 600 }}>
+                    {svc.name}
+                    {svc.expiresAt && (
+                      <div style={{ fontSize: 12, fontWeight: 400, color: '#94a3b8' }}>
+                        lease until {new Date(svc.expiresAt).toLocaleTimeString()}
+                      </div>
+                    )}
+                  </td>
+                  <td style={{ ...s.td, color: '#475569' }}>{(svc.domains ?? [svc.domain]).join(', ')}{svc.path ? `${svc.path}/*` : ''}</td>
+                  <td style={{ ...s.td, fontFamily: 'monospace', fontSize: 13, color: '#475569' }}>
+                    {(svc.upstreams ?? [svc.upstream]).join(', ')}
+                    {svc.lbPolicy && <span style={{ color: '#94a3b8' }}> ({svc.lbPolicy})</span>}
+                  </td>
+                  <td style={s.td}>{healthBadge(health[svc.name])}</td>
                   <td style={s.td}>
                     <button
                       style={deleting === svc.name ? s.deleteBtnDisabled : s.deleteBtn}
@@ -84,3 +103,14 @@ export default function ServiceList() {
     </div>
   )
 }
+
+function healthBadge(h?: ServiceHealth) {
+  if (!h) return <span style={{ color: '#94a3b8' }}>—</span>
+  const down = h.upstreams.filter(u => u.status !== 'up')
+  const title = h.upstreams.map(u => `${u.address}: ${u.status} (${u.fails} fails / ${u.numRequests} reqs)`).join('\n')
+  return (
+    <span title={title} style={{ ...s.badge, ...(h.healthy ? s.up : s.down) }}>
+      {h.healthy ? '● up' : `● ${down.length}/${h.upstreams.length} down`}
+    </span>
+  )
+}
@@ -41,12 +41,13 @@ export default function SiteDetail() {
 
   const rows: { label: string; value: React.ReactNode }[] = [
     { label: 'Domain', value: <span style={s.mono}>{site.domain}</span> },
+    ...(site.aliases ? [{ label: 'Aliases', value: <span style={s.mono}>{site.aliases.join(', ')}</span> }] : []),
     {
       label: 'Type',
       value: <span style={{ ...s.badge, background: site.type === 'proxy' ? '#dbeafe' : site.type === 'static' ? '#f3e8ff' : '#f1f5f9', color: site.type === 'proxy' ? '#1d4ed8' : site.type === 'static' ? '#7e22ce' : '#64748b' }}>{site.type}</span>
     },
     ...(site.type === 'static' ? [{ label: 'Root directory', value: <span style={s.mono}>{site.root ?? '—'}</span> }] : []),
-    ...(site.type === 'proxy' ? [{ label: 'Upstream', value: <span style={s.mono}>{site.upstream ?? '—'}</span> }] : []),
+    ...(site.type === 'proxy' ? [{ label: 'Upstream', value: <span style={s.mono}>{site.upstreams?.join(', ') ?? '—'}{site.lbPolicy ? ` (${site.lbPolicy})` : ''}</span> }] : []),
     { label: 'TLS', value: <span style={{ ...s.badge, ...(site.hasTLS ? s.tls : s.noTls) }}>{site.hasTLS ? '✓ Managed' : '— None'}</span> },
     {
       label: 'Response headers',
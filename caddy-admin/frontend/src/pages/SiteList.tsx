@@ -60,13 +60,13 @@ export default function SiteList() {
             <tbody>
               {sites.map(site => (
                 <tr
-                  key={site.domain}
+                  key={site.domain + (site.paths?.join(',') ?? '')}
                   style={hovered === site.domain ? { ...s.trHover } : {}}
                   onMouseEnter={() => setHovered(site.domain)}
                   onMouseLeave={() => setHovered(null)}
                   onClick={() => navigate(`/sites/${encodeURIComponent(site.domain)}`)}
                 >
-                  <td style={s.td}><strong>{site.domain}</strong></td>
+                  <td style={s.td}><strong>{site.domain}</strong>{site.aliases && <span style={{ color: '#64748b' }}> +{site.aliases.join(', ')}</span>}{site.paths && <span style={{ color: '#64748b' }}> {site.paths.join(' ')}</span>}</td>
                   <td style={s.td}>{typeBadge(site.type)}</td>
                   <td style={{ ...s.td, color: '#475569', fontFamily: 'monospace', fontSize: 13 }}>
                     {site.type === 'proxy' ? site.upstream : site.root ?? '—'}
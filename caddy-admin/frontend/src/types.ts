@@ -1,10 +1,17 @@
 export interface SiteInfo {
   domain: string
+  aliases?: string[]
+  paths?: string[]
   type: 'static' | 'proxy' | 'unknown'
   root?: string
   upstream?: string
+  upstreams?: string[]
+  lbPolicy?: string
   headers?: Record<string, string>
   hasTLS: boolean
+  service?: string
+  server: string
+  tls: boolean
 }
 
 export interface CertInfo {
@@ -14,7 +21,27 @@ export interface CertInfo {
   notAfter: string
   daysLeft: number
   isExpired: boolean
-  source: 'letsencrypt' | 'zerossl' | 'local' | 'unknown'
+  source: 'letsencrypt' | 'zerossl' | 'local' | 'external' | 'unknown'
+  sans: string[]
+  serial: string
+  keyType: string
+  keySize?: number
+  signatureAlgorithm: string
+  fingerprint: string
+  chain: ChainCert[]
+  file?: string
+}
+
+export interface ChainCert {
+  subject: string
+  issuer: string
+  serial: string
+  notBefore: string
+  notAfter: string
+  daysLeft: number
+  isExpired: boolean
+  signatureAlgorithm: string
+  fingerprint: string
 }
 
 export interface SitesResponse {
@@ -26,12 +53,47 @@ export interface CertsResponse {
   certs: CertInfo[]
   total: number
   message?: string
+  probes?: ProbeResult[]
+}
+
+export interface ProbeResult {
+  host: string
+  addr: string
+  status: 'match' | 'stale' | 'mismatch' | 'not_on_disk' | 'error'
+  error?: string
+  protocol?: string
+  alpn?: string
+  chainValid: boolean
+  chainError?: string
+  presented?: CertInfo
+  disk?: { fingerprint: string; domain: string; source: string; notAfter: string; daysLeft: number; matchedSan?: string }
 }
 
 export interface ServiceInfo {
   name: string
   domain: string
+  domains?: string[]
   upstream: string
+  upstreams?: string[]
+  lbPolicy?: string
+  path?: string
+  stripPrefix?: boolean
+  healthCheck?: HealthCheck
+  ttl?: string
+  expiresAt?: string
+  server?: string
+  scheme?: 'http' | 'https'
+  port?: number
+  priority?: number
+}
+
+export interface HealthCheck {
+  path?: string
+  interval?: string
+  timeout?: string
+  expectStatus?: number
+  failDuration?: string
+  maxFails?: number
 }
 
 export interface ServicesResponse {
@@ -39,6 +101,26 @@ export interface ServicesResponse {
   total: number
 }
 
+export interface UpstreamHealth {
+  address: string
+  status: 'up' | 'failing' | 'missing'
+  numRequests: number
+  fails: number
+}
+
+export interface ServiceHealth {
+  name: string
+  domain: string
+  healthy: boolean
+  upstreams: UpstreamHealth[]
+}
+
+export interface UpstreamsResponse {
+  services: ServiceHealth[]
+  total: number
+  other: UpstreamHealth[]
+}
+
 export interface StatusResponse {
   caddy: boolean
 }
@@ -5,6 +5,16 @@ CADDY_ADMIN_URL="${CADDY_ADMIN_URL:-http://caddy-admin-api:8090}"
 SERVICE_NAME="${SERVICE_NAME:-__PROJECT_NAME__}"
 SERVICE_DOMAIN="${SERVICE_DOMAIN:-__PROJECT_NAME__.yeanhua.asia}"
 SERVICE_UPSTREAM="${SERVICE_UPSTREAM:-__PROJECT_NAME__-frontend:80}"
+# Optional lease in seconds. When set, this sidecar keeps running and sends
+# heartbeats; once it stops (docker compose down) the service is reaped.
+SERVICE_TTL="${SERVICE_TTL:-}"
+# API token (register scope, prefix = service name) when caddy-admin has auth enabled
+CADDY_ADMIN_TOKEN="${CADDY_ADMIN_TOKEN:-}"
+
+AUTH_HEADER=""
+if [ -n "${CADDY_ADMIN_TOKEN}" ]; then
+  AUTH_HEADER="Authorization: Bearer ${CADDY_ADMIN_TOKEN}"
+fi
 
 echo "Waiting for caddy-admin API at ${CADDY_ADMIN_URL}..."
 
@@ -22,11 +32,35 @@ for i in $(seq 1 $RETRIES); do
   sleep 2
 done
 
+BODY="{\"name\":\"${SERVICE_NAME}\",\"domain\":\"${SERVICE_DOMAIN}\",\"upstream\":\"${SERVICE_UPSTREAM}\"}"
+if [ -n "${SERVICE_TTL}" ]; then
+  BODY="{\"name\":\"${SERVICE_NAME}\",\"domain\":\"${SERVICE_DOMAIN}\",\"upstream\":\"${SERVICE_UPSTREAM}\",\"ttl\":\"${SERVICE_TTL}s\"}"
+fi
+
+register() {
+  curl -sf -X POST "${CADDY_ADMIN_URL}/api/services" \
+    -H "Content-Type: application/json" \
+    ${AUTH_HEADER:+-H "${AUTH_HEADER}"} \
+    -d "${BODY}"
+}
+
 echo "Registering service: ${SERVICE_NAME} -> ${SERVICE_DOMAIN} -> ${SERVICE_UPSTREAM}"
 
-RESPONSE=$(curl -sf -X POST "${CADDY_ADMIN_URL}/api/services" \
-  -H "Content-Type: application/json" \
-  -d "{\"name\":\"${SERVICE_NAME}\",\"domain\":\"${SERVICE_DOMAIN}\",\"upstream\":\"${SERVICE_UPSTREAM}\"}")
+RESPONSE=$(register)
 
 echo "Response: ${RESPONSE}"
 echo "${SERVICE_NAME} registered successfully."
+
+[ -z "${SERVICE_TTL}" ] && exit 0
+
+INTERVAL=$((SERVICE_TTL / 3))
+[ "${INTERVAL}" -lt 1 ] && INTERVAL=1
+echo "Sending heartbeats every ${INTERVAL}s (ttl ${SERVICE_TTL}s)"
+
+while true; do
+  sleep "${INTERVAL}"
+  if ! curl -sf -X POST ${AUTH_HEADER:+-H "${AUTH_HEADER}"} "${CADDY_ADMIN_URL}/api/services/${SERVICE_NAME}/heartbeat" > /dev/null; then
+    echo "Heartbeat failed, re-registering ${SERVICE_NAME}..."
+    register > /dev/null || echo "  re-register failed, will retry"
+  fi
+done